@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -15,15 +17,23 @@ import (
 	"github.com/crossplane/crossplane-runtime/pkg/logging"
 	xfnaws "github.com/giantswarm/xfnlib/pkg/auth/aws"
 	"github.com/giantswarm/xfnlib/pkg/composite"
+
+	"github.com/giantswarm/crossplane-fn-irsa/pkg/input/v1beta1"
 )
 
 type Route53Api interface {
 	ListHostedZones(ctx context.Context,
 		params *route53.ListHostedZonesInput,
 		optFns ...func(*route53.Options)) (*route53.ListHostedZonesOutput, error)
+	ListHostedZonesByName(ctx context.Context,
+		params *route53.ListHostedZonesByNameInput,
+		optFns ...func(*route53.Options)) (*route53.ListHostedZonesByNameOutput, error)
 	ListTagsForResource(ctx context.Context,
 		params *route53.ListTagsForResourceInput,
 		optFns ...func(*route53.Options)) (*route53.ListTagsForResourceOutput, error)
+	GetHostedZone(ctx context.Context,
+		params *route53.GetHostedZoneInput,
+		optFns ...func(*route53.Options)) (*route53.GetHostedZoneOutput, error)
 }
 
 type CloudFrontApi interface {
@@ -49,49 +59,57 @@ func GetHostedZones(c context.Context, api Route53Api, input *route53.ListHosted
 	return api.ListHostedZones(c, input)
 }
 
+func GetHostedZonesByName(c context.Context, api Route53Api, input *route53.ListHostedZonesByNameInput) (*route53.ListHostedZonesByNameOutput, error) {
+	return api.ListHostedZonesByName(c, input)
+}
+
 func GetTagsForResource(c context.Context, api Route53Api, input *route53.ListTagsForResourceInput) (*route53.ListTagsForResourceOutput, error) {
 	return api.ListTagsForResource(c, input)
 }
 
+func GetDistributions(c context.Context, api CloudFrontApi, input *cloudfront.ListDistributionsInput) (*cloudfront.ListDistributionsOutput, error) {
+	return api.ListDistributions(c, input)
+}
+
 func GetCallerIdentity(c context.Context, api AwsStsApi, input *sts.GetCallerIdentityInput) (*sts.GetCallerIdentityOutput, error) {
 	return api.GetCallerIdentity(c, input)
 }
 
 var (
 	getRoute53Client = func(cfg aws.Config, ep string) Route53Api {
-		if ep != "" {
-			return route53.NewFromConfig(cfg, func(o *route53.Options) {
+		return route53.NewFromConfig(cfg, func(o *route53.Options) {
+			if ep != "" {
 				o.BaseEndpoint = &ep
-			})
-		}
-		return route53.NewFromConfig(cfg)
+			}
+			o.Retryer = accountRetryer{}
+		})
 	}
 
 	getIamClient = func(cfg aws.Config, ep string) IamApi {
-		if ep != "" {
-			return iam.NewFromConfig(cfg, func(o *iam.Options) {
+		return iam.NewFromConfig(cfg, func(o *iam.Options) {
+			if ep != "" {
 				o.BaseEndpoint = &ep
-			})
-		}
-		return iam.NewFromConfig(cfg)
+			}
+			o.Retryer = accountRetryer{}
+		})
 	}
 
 	getCloudFrontClient = func(cfg aws.Config, ep string) CloudFrontApi {
-		if ep != "" {
-			return cloudfront.NewFromConfig(cfg, func(o *cloudfront.Options) {
+		return cloudfront.NewFromConfig(cfg, func(o *cloudfront.Options) {
+			if ep != "" {
 				o.BaseEndpoint = &ep
-			})
-		}
-		return cloudfront.NewFromConfig(cfg)
+			}
+			o.Retryer = accountRetryer{}
+		})
 	}
 
 	getStsClient = func(cfg aws.Config, ep string) AwsStsApi {
-		if ep != "" {
-			return sts.NewFromConfig(cfg, func(o *sts.Options) {
+		return sts.NewFromConfig(cfg, func(o *sts.Options) {
+			if ep != "" {
 				o.BaseEndpoint = &ep
-			})
-		}
-		return sts.NewFromConfig(cfg)
+			}
+			o.Retryer = accountRetryer{}
+		})
 	}
 
 	awsConfig = func(region, providerCfgRef *string, log logging.Logger) (aws.Config, map[string]string, error) {
@@ -105,14 +123,14 @@ var (
 	}
 )
 
-func (f *Function) GetAccountId(region, pcr *string) (id string, err error) {
+func (f *Function) GetAccountId(ctx context.Context, region, pcr *string) (id string, err error) {
 	var (
 		cfg       aws.Config
 		services  map[string]string
 		stsclient AwsStsApi
 	)
 
-	if cfg, services, err = awsConfig(region, pcr, f.log); err != nil {
+	if cfg, services, err = f.getAWSConfig(ctx, *region, *pcr); err != nil {
 		err = errors.Wrap(err, "failed to load aws config")
 		return
 	}
@@ -126,7 +144,7 @@ func (f *Function) GetAccountId(region, pcr *string) (id string, err error) {
 	stsclient = getStsClient(cfg, ep)
 	var identity *sts.GetCallerIdentityOutput
 	{
-		identity, err = GetCallerIdentity(context.Background(), stsclient, &sts.GetCallerIdentityInput{})
+		identity, err = GetCallerIdentity(ctx, stsclient, &sts.GetCallerIdentityInput{})
 		if err != nil {
 			return
 		}
@@ -136,19 +154,57 @@ func (f *Function) GetAccountId(region, pcr *string) (id string, err error) {
 	return
 }
 
-func (f *Function) DiscoverHostedZone(domain string, region string, providerConfigRef string, patchTo string, composed *composite.Composition) (err error) {
+// HostedZoneOptions narrows down which hosted zone is selected for a domain
+type HostedZoneOptions struct {
+	Prefer           v1beta1.HostedZoneVisibility
+	VPCID            string
+	Tags             map[string]string
+	FallbackToParent bool
+}
+
+// String renders the options for use in cache keys
+func (o HostedZoneOptions) String() string {
+	tags := make([]string, 0, len(o.Tags))
+	for k, v := range o.Tags {
+		tags = append(tags, k+"="+v)
+	}
+	sort.Strings(tags)
+
+	return fmt.Sprintf("prefer=%s,vpc=%s,tags=%s,parent=%t", o.Prefer, o.VPCID, strings.Join(tags, ";"), o.FallbackToParent)
+}
+
+// errHostedZoneNotFound is returned when no hosted zone matches the domain
+var errHostedZoneNotFound = errors.New("no hosted zone found matching the domain")
+
+// DiscoverHostedZone returns the ID of the hosted zone serving the domain
+func (f *Function) DiscoverHostedZone(ctx context.Context, domain string, region string, providerConfigRef string, opts HostedZoneOptions) (hostedZoneId string, err error) {
+	f.log.Debug("Discovering hosted zone", "domain", domain, "options", opts.String())
+
+	if hostedZoneId, err = cachedLookup(f.discovery, "route53", func() (string, error) {
+		return f.findHostedZone(ctx, domain, region, providerConfigRef, opts)
+	}, providerConfigRef, region, domain, opts.String()); err != nil {
+		return "", err
+	}
+
+	if hostedZoneId == "" {
+		return "", fmt.Errorf("%w: %s", errHostedZoneNotFound, domain)
+	}
+
+	f.log.Debug("Found hosted zone", "hostedZoneId", hostedZoneId)
+	return hostedZoneId, nil
+}
+
+func (f *Function) findHostedZone(ctx context.Context, domain string, region string, providerConfigRef string, opts HostedZoneOptions) (hostedZoneId string, err error) {
 	var (
 		cfg      aws.Config
 		services map[string]string
 		client   Route53Api
 	)
 
-	f.log.Debug("Discovering hosted zone", "domain", domain)
-
-	if cfg, services, err = awsConfig(&region, &providerConfigRef, f.log); err != nil {
+	if cfg, services, err = f.getAWSConfig(ctx, region, providerConfigRef); err != nil {
 		f.log.Info("Error loading aws config", "error", err)
 		err = errors.Wrap(err, "failed to load aws config with region "+region)
-		return err
+		return
 	}
 
 	var ep string
@@ -159,81 +215,204 @@ func (f *Function) DiscoverHostedZone(domain string, region string, providerConf
 
 	client = getRoute53Client(cfg, ep)
 
-	var hostedZones *route53.ListHostedZonesOutput
-	hostedZones, err = GetHostedZones(context.Background(), client, &route53.ListHostedZonesInput{})
-	if err != nil {
-		f.log.Info("Error listing hosted zones", "error", err)
-		return err
-	}
-
-	// Fetch all hosted zones by paginating through results
-	var allHostedZones []route53types.HostedZone
-	allHostedZones = append(allHostedZones, hostedZones.HostedZones...)
-
-	// Continue fetching if there are more hosted zones
-	for hostedZones.IsTruncated {
-		var nextMarker *string
-		if hostedZones.NextMarker != nil {
-			nextMarker = hostedZones.NextMarker
-		} else if len(hostedZones.HostedZones) > 0 {
-			// If NextMarker is not provided, use the ID of the last hosted zone
-			nextMarker = hostedZones.HostedZones[len(hostedZones.HostedZones)-1].Id
+	for _, name := range hostedZoneCandidateNames(domain, opts.FallbackToParent) {
+		var matchingHostedZones []route53types.HostedZone
+		if matchingHostedZones, err = f.listHostedZonesNamed(ctx, client, name); err != nil {
+			return
 		}
 
-		hostedZones, err = GetHostedZones(context.Background(), client, &route53.ListHostedZonesInput{
-			Marker:   nextMarker,
-			MaxItems: aws.Int32(100),
-		})
-		if err != nil {
-			f.log.Info("Error listing additional hosted zones", "error", err)
-			return err
+		if matchingHostedZones, err = f.filterHostedZones(ctx, client, matchingHostedZones, opts); err != nil {
+			return
+		}
+
+		f.log.Debug("matching hosted zones", "name", name, "matchingHostedZones", matchingHostedZones)
+
+		if len(matchingHostedZones) == 0 {
+			continue
+		}
+
+		if len(matchingHostedZones) > 1 {
+			err = errors.New("multiple hosted zones found matching the domain: " + name)
+			return
+		}
+
+		if name != domain {
+			f.log.Info("Using parent hosted zone", "domain", domain, "zone", name)
 		}
 
-		allHostedZones = append(allHostedZones, hostedZones.HostedZones...)
+		hostedZoneId = strings.TrimPrefix(*matchingHostedZones[0].Id, "/hostedzone/")
+		return
 	}
 
-	f.log.Debug("Total hosted zones found", "count", len(allHostedZones))
+	return
+}
+
+// listHostedZonesNamed returns every hosted zone with exactly the given name.
+//
+// ListHostedZonesByName returns zones sorted by name starting at the requested
+// DNS name, so listing stops as soon as a zone with a different name is seen
+// instead of paging through every zone in the account.
+func (f *Function) listHostedZonesNamed(ctx context.Context, client Route53Api, name string) (zones []route53types.HostedZone, err error) {
+	input := &route53.ListHostedZonesByNameInput{
+		DNSName: aws.String(name),
+	}
 
-	var matchingHostedZones []route53types.HostedZone
-	for _, hz := range allHostedZones {
-		zoneName := strings.TrimSuffix(*hz.Name, ".")
-		if zoneName == domain {
-			matchingHostedZones = append(matchingHostedZones, hz)
+	for {
+		var hostedZones *route53.ListHostedZonesByNameOutput
+		if hostedZones, err = GetHostedZonesByName(ctx, client, input); err != nil {
+			f.log.Info("Error listing hosted zones by name", "error", err, "name", name)
+			return
+		}
+
+		for _, hz := range hostedZones.HostedZones {
+			if !strings.EqualFold(strings.TrimSuffix(aws.ToString(hz.Name), "."), name) {
+				return
+			}
+			zones = append(zones, hz)
+		}
+
+		if !hostedZones.IsTruncated || !strings.EqualFold(strings.TrimSuffix(aws.ToString(hostedZones.NextDNSName), "."), name) {
+			return
+		}
+
+		input = &route53.ListHostedZonesByNameInput{
+			DNSName:      hostedZones.NextDNSName,
+			HostedZoneId: hostedZones.NextHostedZoneId,
 		}
 	}
+}
 
-	f.log.Debug("matching hosted zones", "matchingHostedZones", matchingHostedZones)
+// hostedZoneCandidateNames returns the zone names to try for the domain, the
+// domain itself first followed by its parents when fallback is enabled. The
+// top level domain on its own is never a candidate.
+func hostedZoneCandidateNames(domain string, fallbackToParent bool) (names []string) {
+	names = append(names, domain)
+	if !fallbackToParent {
+		return
+	}
 
-	if len(matchingHostedZones) == 0 {
-		err = errors.New("no hosted zone found matching the domain: " + domain)
-		return err
+	labels := strings.Split(domain, ".")
+	for i := 1; i < len(labels)-1; i++ {
+		names = append(names, strings.Join(labels[i:], "."))
 	}
+	return
+}
+
+// filterHostedZones applies the tag, VPC and visibility options to zones
+// sharing the same name.
+func (f *Function) filterHostedZones(ctx context.Context, client Route53Api, zones []route53types.HostedZone, opts HostedZoneOptions) (filtered []route53types.HostedZone, err error) {
+	for _, hz := range zones {
+		zoneId := strings.TrimPrefix(aws.ToString(hz.Id), "/hostedzone/")
+		private := hz.Config != nil && hz.Config.PrivateZone
+
+		if opts.VPCID != "" {
+			if !private {
+				continue
+			}
+
+			var zone *route53.GetHostedZoneOutput
+			if zone, err = client.GetHostedZone(ctx, &route53.GetHostedZoneInput{Id: aws.String(zoneId)}); err != nil {
+				f.log.Info("Error getting hosted zone", "error", err, "hostedZoneId", zoneId)
+				return
+			}
+
+			associated := false
+			for _, vpc := range zone.VPCs {
+				if aws.ToString(vpc.VPCId) == opts.VPCID {
+					associated = true
+					break
+				}
+			}
 
-	if len(matchingHostedZones) > 1 {
-		err = errors.New("multiple hosted zones found matching the domain: " + domain)
-		return err
+			if !associated {
+				f.log.Debug("Hosted zone not associated with VPC", "hostedZoneId", zoneId, "vpcId", opts.VPCID)
+				continue
+			}
+		}
+
+		if len(opts.Tags) > 0 {
+			var tags *route53.ListTagsForResourceOutput
+			if tags, err = GetTagsForResource(ctx, client, &route53.ListTagsForResourceInput{
+				ResourceId:   aws.String(zoneId),
+				ResourceType: route53types.TagResourceTypeHostedzone,
+			}); err != nil {
+				f.log.Info("Error listing tags for hosted zone", "error", err, "hostedZoneId", zoneId)
+				return
+			}
+
+			zoneTags := make(map[string]string)
+			if tags.ResourceTagSet != nil {
+				for _, tag := range tags.ResourceTagSet.Tags {
+					zoneTags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+				}
+			}
+
+			matches := true
+			for k, v := range opts.Tags {
+				if value, ok := zoneTags[k]; !ok || value != v {
+					matches = false
+					break
+				}
+			}
+
+			if !matches {
+				f.log.Debug("Hosted zone tags do not match", "hostedZoneId", zoneId, "tags", zoneTags)
+				continue
+			}
+		}
+
+		filtered = append(filtered, hz)
 	}
 
-	hostedZoneId := strings.TrimPrefix(*matchingHostedZones[0].Id, "/hostedzone/")
-	f.log.Debug("Found hosted zone", "hostedZoneId", hostedZoneId)
+	if opts.Prefer == "" || len(filtered) < 2 {
+		return
+	}
 
-	err = f.patchFieldValueToObject(patchTo, hostedZoneId, composed.DesiredComposite.Resource)
-	return err
+	var preferred []route53types.HostedZone
+	for _, hz := range filtered {
+		private := hz.Config != nil && hz.Config.PrivateZone
+		if private == (opts.Prefer == v1beta1.HostedZoneVisibilityPrivate) {
+			preferred = append(preferred, hz)
+		}
+	}
+
+	if len(preferred) > 0 {
+		filtered = preferred
+	}
+	return
 }
 
-func (f *Function) DiscoverDistribution(domain string, region string, providerConfigRef string, composed *composite.Composition) (err error) {
+// DiscoverDistribution returns the ID of the CloudFront distribution serving
+// the domain, or an empty ID if there is none
+func (f *Function) DiscoverDistribution(ctx context.Context, domain string, region string, providerConfigRef string) (distributionId string, err error) {
+	f.log.Debug("Discovering CloudFront distribution", "domain", domain, "region", region)
+
+	if distributionId, err = cachedLookup(f.discovery, "cloudfront", func() (string, error) {
+		return f.findDistribution(ctx, domain, region, providerConfigRef)
+	}, providerConfigRef, region, domain); err != nil {
+		return "", err
+	}
+
+	if distributionId == "" {
+		f.log.Debug("No matching distribution found", "domain", domain)
+		return "", nil
+	}
+
+	f.log.Info("Found matching distribution", "distributionId", distributionId, "domain", domain)
+	return distributionId, nil
+}
+
+func (f *Function) findDistribution(ctx context.Context, domain string, region string, providerConfigRef string) (distributionId string, err error) {
 	var (
 		cfg      aws.Config
 		services map[string]string
 		client   CloudFrontApi
 	)
 
-	f.log.Debug("Discovering CloudFront distribution", "domain", domain, "region", region)
-
-	if cfg, services, err = awsConfig(&region, &providerConfigRef, f.log); err != nil {
+	if cfg, services, err = f.getAWSConfig(ctx, region, providerConfigRef); err != nil {
 		f.log.Info("Failed to load AWS config", "error", err, "region", region)
 		err = errors.Wrap(err, "failed to load aws config")
-		return err
+		return
 	}
 
 	var ep string
@@ -245,17 +424,42 @@ func (f *Function) DiscoverDistribution(domain string, region string, providerCo
 
 	client = getCloudFrontClient(cfg, ep)
 
-	var distributions *cloudfront.ListDistributionsOutput
-	distributions, err = client.ListDistributions(context.Background(), &cloudfront.ListDistributionsInput{})
-	if err != nil {
-		f.log.Info("Failed to list CloudFront distributions", "error", err)
-		return err
+	// Fetch all distributions by paginating through results
+	var (
+		allDistributions []cloudfronttypes.DistributionSummary
+		marker           *string
+	)
+	for {
+		var distributions *cloudfront.ListDistributionsOutput
+		distributions, err = GetDistributions(ctx, client, &cloudfront.ListDistributionsInput{
+			Marker: marker,
+		})
+		if err != nil {
+			f.log.Info("Failed to list CloudFront distributions", "error", err)
+			return
+		}
+
+		list := distributions.DistributionList
+		if list == nil {
+			break
+		}
+
+		allDistributions = append(allDistributions, list.Items...)
+
+		if !aws.ToBool(list.IsTruncated) || aws.ToString(list.NextMarker) == "" {
+			break
+		}
+		marker = list.NextMarker
 	}
 
-	f.log.Debug("Found distributions", "count", len(distributions.DistributionList.Items))
+	f.log.Debug("Found distributions", "count", len(allDistributions))
 
 	var matchingDistributions []cloudfronttypes.DistributionSummary
-	for _, dist := range distributions.DistributionList.Items {
+	for _, dist := range allDistributions {
+		if dist.Aliases == nil {
+			continue
+		}
+
 		for _, alias := range dist.Aliases.Items {
 			if alias == domain {
 				matchingDistributions = append(matchingDistributions, dist)
@@ -265,41 +469,95 @@ func (f *Function) DiscoverDistribution(domain string, region string, providerCo
 	}
 
 	if len(matchingDistributions) == 0 {
-		f.log.Debug("No matching distribution found", "domain", domain)
-		return nil
+		return
 	}
 
 	if len(matchingDistributions) > 1 {
 		err = errors.New("multiple distributions found matching the domain: " + domain)
 		f.log.Info("Multiple matching distributions found", "error", err, "domain", domain, "count", len(matchingDistributions))
-		return err
+		return
 	}
 
-	distributionId := matchingDistributions[0].Id
-	f.log.Info("Found matching distribution", "distributionId", distributionId, "domain", domain)
+	distributionId = *matchingDistributions[0].Id
+	return
+}
 
-	err = f.patchFieldValueToObject("status.importResources.cloudfrontDistributionId", distributionId, composed.DesiredComposite.Resource)
-	if err != nil {
-		f.log.Info("Failed to patch distribution ID", "error", err, "distributionId", distributionId)
-		return err
+// OpenIdProvider is an IAM OpenID Connect provider matching the issuer
+type OpenIdProvider struct {
+	Arn            string
+	Url            string
+	ClientIDList   []string
+	ThumbprintList []string
+}
+
+// DiscoverOpenIdProvider returns the OpenID Connect provider of the issuer, or
+// nil if there is none
+func (f *Function) DiscoverOpenIdProvider(ctx context.Context, issuer string, region string, providerConfigRef string) (provider *OpenIdProvider, err error) {
+	f.log.Debug("Discovering OpenID Connect provider", "issuer", issuer, "region", region)
+
+	if provider, err = cachedLookup(f.discovery, "iam", func() (*OpenIdProvider, error) {
+		return f.findOpenIdProvider(ctx, issuer, region, providerConfigRef)
+	}, providerConfigRef, region, issuer); err != nil {
+		return nil, err
+	}
+
+	if provider == nil {
+		f.log.Debug("No matching provider found", "issuer", issuer)
+		return nil, nil
+	}
+
+	f.log.Info("Found matching OpenID Connect provider", "arn", provider.Arn, "issuer", issuer)
+	return provider, nil
+}
+
+// patchOpenIdProvider patches the import values of a discovered OpenID
+// Connect provider to the desired XR
+func (f *Function) patchOpenIdProvider(provider *OpenIdProvider, composed *composite.Composition) (err error) {
+	if provider == nil {
+		return nil
+	}
+
+	// Nil lists would be patched as null, IAM omits empty lists
+	for ref, value := range map[string]any{
+		openIdProviderArnRef:         provider.Arn,
+		openIdProviderThumbprintsRef: nonNil(provider.ThumbprintList),
+		openIdProviderClientIdsRef:   nonNil(provider.ClientIDList),
+	} {
+		if err = f.patchFieldValueToObject(ref, value, composed.DesiredComposite.Resource); err != nil {
+			f.log.Info("Failed to patch OpenID Connect provider", "error", err, "arn", provider.Arn, "ref", ref)
+			return err
+		}
 	}
 
 	return nil
 }
 
-func (f *Function) DiscoverOpenIdProvider(domain string, region string, providerConfigRef string, composed *composite.Composition) (err error) {
+// nonNil returns an empty slice in place of a nil one
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
+
+// findOpenIdProvider looks for the OpenID Connect provider whose URL is
+// exactly the given issuer.
+//
+// ListOpenIDConnectProviders is not paginated and always returns every
+// provider in the account. Candidates are preselected by the URL embedded in
+// their ARN and then confirmed against the URL returned by
+// GetOpenIDConnectProvider.
+func (f *Function) findOpenIdProvider(ctx context.Context, issuer string, region string, providerConfigRef string) (provider *OpenIdProvider, err error) {
 	var (
 		cfg      aws.Config
 		services map[string]string
 		client   IamApi
 	)
 
-	f.log.Debug("Discovering OpenID Connect provider", "domain", domain, "region", region)
-
-	if cfg, services, err = awsConfig(&region, &providerConfigRef, f.log); err != nil {
+	if cfg, services, err = f.getAWSConfig(ctx, region, providerConfigRef); err != nil {
 		f.log.Info("Failed to load AWS config", "error", err, "region", region)
 		err = errors.Wrap(err, "failed to load aws config")
-		return err
+		return
 	}
 
 	var ep string
@@ -312,35 +570,59 @@ func (f *Function) DiscoverOpenIdProvider(domain string, region string, provider
 	client = getIamClient(cfg, ep)
 
 	var providers *iam.ListOpenIDConnectProvidersOutput
-	providers, err = client.ListOpenIDConnectProviders(context.Background(), &iam.ListOpenIDConnectProvidersInput{})
+	providers, err = client.ListOpenIDConnectProviders(ctx, &iam.ListOpenIDConnectProvidersInput{})
 	if err != nil {
 		f.log.Info("Failed to list OpenID Connect providers", "error", err)
-		return err
+		return
 	}
 
 	f.log.Debug("Found OpenID Connect providers", "count", len(providers.OpenIDConnectProviderList))
 
-	var matchingProviderArn string
-	for _, providerArn := range providers.OpenIDConnectProviderList {
-		if strings.Contains(*providerArn.Arn, domain) {
-			matchingProviderArn = *providerArn.Arn
-			f.log.Debug("Found matching provider", "arn", matchingProviderArn)
-			break
+	expected := normalizeIssuer(issuer)
+	arnPrefix := PartitionForRegion(region).ARNPrefix("iam")
+
+	var matching []*OpenIdProvider
+	for _, entry := range providers.OpenIDConnectProviderList {
+		arn := aws.ToString(entry.Arn)
+		if !strings.HasPrefix(arn, arnPrefix) || !strings.HasSuffix(arn, ":oidc-provider/"+expected) {
+			continue
 		}
-	}
 
-	if matchingProviderArn == "" {
-		f.log.Debug("No matching provider found", "domain", domain)
-		return nil
+		var details *iam.GetOpenIDConnectProviderOutput
+		if details, err = client.GetOpenIDConnectProvider(ctx, &iam.GetOpenIDConnectProviderInput{
+			OpenIDConnectProviderArn: entry.Arn,
+		}); err != nil {
+			f.log.Info("Failed to get OpenID Connect provider", "error", err, "arn", arn)
+			return
+		}
+
+		if normalizeIssuer(aws.ToString(details.Url)) != expected {
+			f.log.Debug("Provider URL does not match issuer", "arn", arn, "url", aws.ToString(details.Url))
+			continue
+		}
+
+		f.log.Debug("Found matching provider", "arn", arn)
+		matching = append(matching, &OpenIdProvider{
+			Arn:            arn,
+			Url:            aws.ToString(details.Url),
+			ClientIDList:   details.ClientIDList,
+			ThumbprintList: details.ThumbprintList,
+		})
 	}
 
-	f.log.Info("Found matching OpenID Connect provider", "arn", matchingProviderArn, "domain", domain)
+	if len(matching) > 1 {
+		err = errors.Errorf("multiple OpenID Connect providers found matching the issuer: %s", issuer)
+		return
+	}
 
-	err = f.patchFieldValueToObject("status.importResources.openIdProviderArn", matchingProviderArn, composed.DesiredComposite.Resource)
-	if err != nil {
-		f.log.Info("Failed to patch provider ARN", "error", err, "arn", matchingProviderArn)
-		return err
+	if len(matching) == 1 {
+		provider = matching[0]
 	}
+	return
+}
 
-	return nil
+// normalizeIssuer strips the scheme and any trailing slash so that issuer
+// URLs compare equal to the URL stored by IAM.
+func normalizeIssuer(issuer string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(issuer, "https://"), "/")
 }
@@ -0,0 +1,585 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudfront"
+	cloudfronttypes "github.com/aws/aws-sdk-go-v2/service/cloudfront/types"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	route53types "github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+	"github.com/crossplane/crossplane-runtime/pkg/fieldpath"
+
+	"github.com/giantswarm/crossplane-fn-irsa/pkg/input/v1beta1"
+)
+
+// newTestAWSFunction returns a function with a cached AWS config for the
+// ProviderConfig and region, so that no ProviderConfig is read
+func newTestAWSFunction(providerConfigRef, region string) *Function {
+	f := newTestFunction()
+	f.clients = newClientCache(0)
+	f.clients.configs[providerConfigRef+"/"+region] = &awsConfigEntry{
+		cfg:      aws.Config{Region: region},
+		services: map[string]string{},
+		expires:  time.Now().Add(time.Hour),
+	}
+	return f
+}
+
+// fakeCloudFront serves distributions in pages of pageSize
+type fakeCloudFront struct {
+	distributions []cloudfronttypes.DistributionSummary
+	pageSize      int
+	calls         int
+}
+
+func (c *fakeCloudFront) ListDistributions(_ context.Context, params *cloudfront.ListDistributionsInput, _ ...func(*cloudfront.Options)) (*cloudfront.ListDistributionsOutput, error) {
+	c.calls++
+
+	start := 0
+	if params.Marker != nil {
+		start, _ = strconv.Atoi(*params.Marker)
+	}
+	end := min(start+c.pageSize, len(c.distributions))
+
+	list := &cloudfronttypes.DistributionList{
+		Items:       c.distributions[start:end],
+		IsTruncated: aws.Bool(end < len(c.distributions)),
+	}
+	if end < len(c.distributions) {
+		list.NextMarker = aws.String(strconv.Itoa(end))
+	}
+	return &cloudfront.ListDistributionsOutput{DistributionList: list}, nil
+}
+
+func withCloudFrontClient(t *testing.T, client CloudFrontApi) {
+	t.Helper()
+	orig := getCloudFrontClient
+	getCloudFrontClient = func(aws.Config, string) CloudFrontApi { return client }
+	t.Cleanup(func() { getCloudFrontClient = orig })
+}
+
+func distributions(n int, aliases map[int]string) []cloudfronttypes.DistributionSummary {
+	d := make([]cloudfronttypes.DistributionSummary, n)
+	for i := range d {
+		d[i].Id = aws.String("E" + strconv.Itoa(i))
+		if alias, ok := aliases[i]; ok {
+			d[i].Aliases = &cloudfronttypes.Aliases{Items: []string{"other.example.com", alias}}
+		}
+	}
+	return d
+}
+
+func TestDiscoverDistribution(t *testing.T) {
+	const domain = "irsa.test.example.com"
+
+	cases := map[string]struct {
+		distributions []cloudfronttypes.DistributionSummary
+		want          string
+		wantCalls     int
+		err           bool
+	}{
+		"FirstPage": {
+			distributions: distributions(250, map[int]string{3: domain}),
+			want:          "E3",
+			wantCalls:     3,
+		},
+		"LaterPage": {
+			distributions: distributions(250, map[int]string{230: domain}),
+			want:          "E230",
+			wantCalls:     3,
+		},
+		"NoMatch": {
+			distributions: distributions(250, map[int]string{10: "irsa.other.example.com"}),
+			wantCalls:     3,
+		},
+		"DuplicateAcrossPages": {
+			distributions: distributions(250, map[int]string{5: domain, 240: domain}),
+			wantCalls:     3,
+			err:           true,
+		},
+		"Empty": {
+			wantCalls: 1,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			client := &fakeCloudFront{distributions: tc.distributions, pageSize: 100}
+			withCloudFrontClient(t, client)
+
+			got, err := newTestAWSFunction("default", "eu-west-1").DiscoverDistribution(context.Background(), domain, "eu-west-1", "default")
+			if (err != nil) != tc.err {
+				t.Fatalf("DiscoverDistribution() error = %v, want error %t", err, tc.err)
+			}
+			if got != tc.want {
+				t.Errorf("DiscoverDistribution() = %q, want %q", got, tc.want)
+			}
+			if client.calls != tc.wantCalls {
+				t.Errorf("ListDistributions() calls = %d, want %d", client.calls, tc.wantCalls)
+			}
+		})
+	}
+}
+
+// fakeRoute53 serves hosted zones in pages the way Route53 does:
+// ListHostedZones in creation order, ListHostedZonesByName sorted by the
+// reversed labels of the name and then by ID.
+type fakeRoute53 struct {
+	zones    []route53types.HostedZone
+	tags     map[string]map[string]string
+	vpcs     map[string]string
+	pageSize int
+
+	listCalls   int
+	byNameCalls int
+}
+
+func (c *fakeRoute53) page(start, total int) int {
+	size := c.pageSize
+	if size == 0 {
+		size = 100
+	}
+	return min(start+size, total)
+}
+
+func (c *fakeRoute53) ListHostedZones(_ context.Context, params *route53.ListHostedZonesInput, _ ...func(*route53.Options)) (*route53.ListHostedZonesOutput, error) {
+	c.listCalls++
+
+	start := 0
+	if params.Marker != nil {
+		start = slices.IndexFunc(c.zones, func(hz route53types.HostedZone) bool { return *hz.Id == *params.Marker })
+	}
+	end := c.page(start, len(c.zones))
+
+	out := &route53.ListHostedZonesOutput{HostedZones: c.zones[start:end], IsTruncated: end < len(c.zones)}
+	if out.IsTruncated {
+		out.NextMarker = c.zones[end].Id
+	}
+	return out, nil
+}
+
+// byNameKey orders zones like ListHostedZonesByName
+func byNameKey(hz route53types.HostedZone) string {
+	labels := strings.Split(strings.ToLower(strings.TrimSuffix(*hz.Name, ".")), ".")
+	slices.Reverse(labels)
+	return strings.Join(labels, ".") + "\x00" + *hz.Id
+}
+
+func (c *fakeRoute53) ListHostedZonesByName(_ context.Context, params *route53.ListHostedZonesByNameInput, _ ...func(*route53.Options)) (*route53.ListHostedZonesByNameOutput, error) {
+	c.byNameCalls++
+
+	if params.HostedZoneId != nil && params.DNSName == nil {
+		return nil, errors.New("HostedZoneId requires DNSName")
+	}
+
+	sorted := slices.Clone(c.zones)
+	slices.SortFunc(sorted, func(a, b route53types.HostedZone) int { return strings.Compare(byNameKey(a), byNameKey(b)) })
+
+	start := 0
+	if params.DNSName != nil {
+		from := route53types.HostedZone{Name: params.DNSName, Id: aws.String("")}
+		if params.HostedZoneId != nil {
+			from.Id = params.HostedZoneId
+		}
+		start, _ = slices.BinarySearchFunc(sorted, byNameKey(from), func(hz route53types.HostedZone, key string) int {
+			return strings.Compare(byNameKey(hz), key)
+		})
+	}
+	end := c.page(start, len(sorted))
+
+	out := &route53.ListHostedZonesByNameOutput{HostedZones: sorted[start:end], IsTruncated: end < len(sorted)}
+	if out.IsTruncated {
+		out.NextDNSName, out.NextHostedZoneId = sorted[end].Name, sorted[end].Id
+	}
+	return out, nil
+}
+
+func (c *fakeRoute53) ListTagsForResource(_ context.Context, params *route53.ListTagsForResourceInput, _ ...func(*route53.Options)) (*route53.ListTagsForResourceOutput, error) {
+	set := &route53types.ResourceTagSet{ResourceId: params.ResourceId}
+	for k, v := range c.tags[*params.ResourceId] {
+		set.Tags = append(set.Tags, route53types.Tag{Key: aws.String(k), Value: aws.String(v)})
+	}
+	return &route53.ListTagsForResourceOutput{ResourceTagSet: set}, nil
+}
+
+func (c *fakeRoute53) GetHostedZone(_ context.Context, params *route53.GetHostedZoneInput, _ ...func(*route53.Options)) (*route53.GetHostedZoneOutput, error) {
+	out := &route53.GetHostedZoneOutput{}
+	if vpc, ok := c.vpcs[*params.Id]; ok {
+		out.VPCs = []route53types.VPC{{VPCId: aws.String(vpc)}}
+	}
+	return out, nil
+}
+
+func withRoute53Client(t *testing.T, client Route53Api) {
+	t.Helper()
+	orig := getRoute53Client
+	getRoute53Client = func(aws.Config, string) Route53Api { return client }
+	t.Cleanup(func() { getRoute53Client = orig })
+}
+
+// fullScanHostedZone selects the hosted zone the way discovery did before it
+// used ListHostedZonesByName, by listing every zone in the account
+func fullScanHostedZone(ctx context.Context, f *Function, client Route53Api, domain string, opts HostedZoneOptions) (string, error) {
+	var all []route53types.HostedZone
+	input := &route53.ListHostedZonesInput{}
+	for {
+		out, err := client.ListHostedZones(ctx, input)
+		if err != nil {
+			return "", err
+		}
+		all = append(all, out.HostedZones...)
+		if !out.IsTruncated {
+			break
+		}
+		input = &route53.ListHostedZonesInput{Marker: out.NextMarker}
+	}
+
+	for _, name := range hostedZoneCandidateNames(domain, opts.FallbackToParent) {
+		var matching []route53types.HostedZone
+		for _, hz := range all {
+			if strings.TrimSuffix(*hz.Name, ".") == name {
+				matching = append(matching, hz)
+			}
+		}
+
+		matching, err := f.filterHostedZones(ctx, client, matching, opts)
+		if err != nil {
+			return "", err
+		}
+		if len(matching) > 1 {
+			return "", errors.New("multiple hosted zones found matching the domain: " + name)
+		}
+		if len(matching) == 1 {
+			return strings.TrimPrefix(*matching[0].Id, "/hostedzone/"), nil
+		}
+	}
+
+	return "", fmt.Errorf("%w: %s", errHostedZoneNotFound, domain)
+}
+
+// testHostedZones returns thousands of hosted zones surrounding the zones of
+// a test case, which are placed to straddle page boundaries
+func testHostedZones(zones ...route53types.HostedZone) []route53types.HostedZone {
+	var all []route53types.HostedZone
+	for i := range 3000 {
+		all = append(all, hostedZone(fmt.Sprintf("Z%05d", i), fmt.Sprintf("cluster%04d.example.com", i), false))
+	}
+	for i := range 1000 {
+		all = append(all, hostedZone(fmt.Sprintf("Y%05d", i), fmt.Sprintf("svc%04d.test.example.com", i), i%2 == 0))
+	}
+
+	// Interleave the zones of the case so listing them in creation order
+	// spans several pages
+	for i, hz := range zones {
+		at := (i*1237 + 99) % len(all)
+		all = slices.Insert(all, at, hz)
+	}
+	return all
+}
+
+func hostedZone(id, name string, private bool) route53types.HostedZone {
+	return route53types.HostedZone{
+		Id:     aws.String("/hostedzone/" + id),
+		Name:   aws.String(name + "."),
+		Config: &route53types.HostedZoneConfig{PrivateZone: private},
+	}
+}
+
+func TestDiscoverHostedZone(t *testing.T) {
+	const domain = "test.example.com"
+
+	cases := map[string]struct {
+		zones []route53types.HostedZone
+		tags  map[string]map[string]string
+		vpcs  map[string]string
+		opts  HostedZoneOptions
+
+		want     string
+		err      bool
+		notFound bool
+		maxCall  int
+	}{
+		"Unique": {
+			zones:   []route53types.HostedZone{hostedZone("AAA", domain, false)},
+			want:    "AAA",
+			maxCall: 1,
+		},
+		"DuplicateName": {
+			zones:   []route53types.HostedZone{hostedZone("AAA", domain, false), hostedZone("BBB", domain, false)},
+			err:     true,
+			maxCall: 1,
+		},
+		"DuplicatePreferPrivate": {
+			zones:   []route53types.HostedZone{hostedZone("AAA", domain, false), hostedZone("BBB", domain, true)},
+			opts:    HostedZoneOptions{Prefer: v1beta1.HostedZoneVisibilityPrivate},
+			want:    "BBB",
+			maxCall: 1,
+		},
+		"DuplicateFilteredByTags": {
+			zones:   []route53types.HostedZone{hostedZone("AAA", domain, false), hostedZone("BBB", domain, false)},
+			tags:    map[string]map[string]string{"BBB": {"owner": "platform"}},
+			opts:    HostedZoneOptions{Tags: map[string]string{"owner": "platform"}},
+			want:    "BBB",
+			maxCall: 1,
+		},
+		"DuplicateFilteredByVPC": {
+			zones:   []route53types.HostedZone{hostedZone("AAA", domain, true), hostedZone("BBB", domain, true)},
+			vpcs:    map[string]string{"AAA": "vpc-1", "BBB": "vpc-2"},
+			opts:    HostedZoneOptions{VPCID: "vpc-2"},
+			want:    "BBB",
+			maxCall: 1,
+		},
+		"NoMatch": {
+			zones:    []route53types.HostedZone{hostedZone("AAA", "other.example.com", false)},
+			notFound: true,
+			maxCall:  1,
+		},
+		"NoParentFallback": {
+			zones:    []route53types.HostedZone{hostedZone("AAA", "example.com", false)},
+			notFound: true,
+			maxCall:  1,
+		},
+		"ParentFallback": {
+			zones:   []route53types.HostedZone{hostedZone("AAA", "example.com", false)},
+			opts:    HostedZoneOptions{FallbackToParent: true},
+			want:    "AAA",
+			maxCall: 2,
+		},
+		"ParentFallbackNoMatch": {
+			zones:    []route53types.HostedZone{hostedZone("AAA", "example.org", false)},
+			opts:     HostedZoneOptions{FallbackToParent: true},
+			notFound: true,
+			maxCall:  2,
+		},
+		"ExactPreferredOverParent": {
+			zones:   []route53types.HostedZone{hostedZone("AAA", "example.com", false), hostedZone("BBB", domain, false)},
+			opts:    HostedZoneOptions{FallbackToParent: true},
+			want:    "BBB",
+			maxCall: 1,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			client := &fakeRoute53{zones: testHostedZones(tc.zones...), tags: tc.tags, vpcs: tc.vpcs}
+			withRoute53Client(t, client)
+
+			f := newTestAWSFunction("default", "eu-west-1")
+			ctx := context.Background()
+
+			wantID, wantErr := fullScanHostedZone(ctx, f, client, domain, tc.opts)
+			if client.listCalls < 40 {
+				t.Fatalf("full scan listed %d pages, want every zone listed", client.listCalls)
+			}
+
+			got, err := f.DiscoverHostedZone(ctx, domain, "eu-west-1", "default", tc.opts)
+			if (err != nil) != (wantErr != nil) || errors.Is(err, errHostedZoneNotFound) != errors.Is(wantErr, errHostedZoneNotFound) {
+				t.Fatalf("DiscoverHostedZone() error = %v, full scan error = %v", err, wantErr)
+			}
+			if got != wantID {
+				t.Errorf("DiscoverHostedZone() = %q, full scan = %q", got, wantID)
+			}
+
+			if tc.err && (err == nil || errors.Is(err, errHostedZoneNotFound)) {
+				t.Errorf("DiscoverHostedZone() error = %v, want a lookup error", err)
+			}
+			if tc.notFound && !errors.Is(err, errHostedZoneNotFound) {
+				t.Errorf("DiscoverHostedZone() error = %v, want %v", err, errHostedZoneNotFound)
+			}
+			if got != tc.want {
+				t.Errorf("DiscoverHostedZone() = %q, want %q", got, tc.want)
+			}
+
+			if client.byNameCalls == 0 || client.byNameCalls > tc.maxCall {
+				t.Errorf("ListHostedZonesByName() calls = %d, want 1 to %d", client.byNameCalls, tc.maxCall)
+			}
+		})
+	}
+}
+
+// TestListHostedZonesNamedAcrossPages ensures zones sharing a name are all
+// returned when they span pages, and that listing stops at the first page
+// holding another name.
+func TestListHostedZonesNamedAcrossPages(t *testing.T) {
+	const domain = "test.example.com"
+
+	zones := testHostedZones(
+		hostedZone("AAA", domain, false),
+		hostedZone("BBB", domain, true),
+		hostedZone("CCC", domain, false),
+	)
+
+	cases := map[string]struct {
+		pageSize  int
+		wantCalls int
+	}{
+		"SinglePage":            {pageSize: 100, wantCalls: 1},
+		"DuplicatesSpanPages":   {pageSize: 2, wantCalls: 2},
+		"NextPageStartsAtOther": {pageSize: 3, wantCalls: 1},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			client := &fakeRoute53{zones: zones, pageSize: tc.pageSize}
+
+			got, err := newTestFunction().listHostedZonesNamed(context.Background(), client, domain)
+			if err != nil {
+				t.Fatalf("listHostedZonesNamed() error = %v", err)
+			}
+
+			var ids []string
+			for _, hz := range got {
+				ids = append(ids, *hz.Id)
+			}
+			want := []string{"/hostedzone/AAA", "/hostedzone/BBB", "/hostedzone/CCC"}
+			if !slices.Equal(ids, want) {
+				t.Errorf("listHostedZonesNamed() = %v, want %v", ids, want)
+			}
+			if client.byNameCalls != tc.wantCalls {
+				t.Errorf("ListHostedZonesByName() calls = %d, want %d", client.byNameCalls, tc.wantCalls)
+			}
+		})
+	}
+}
+
+// fakeIam serves OpenID Connect providers keyed by ARN, with the URL returned
+// by GetOpenIDConnectProvider as value
+type fakeIam struct {
+	providers map[string]string
+	gets      []string
+}
+
+func (c *fakeIam) ListOpenIDConnectProviders(context.Context, *iam.ListOpenIDConnectProvidersInput, ...func(*iam.Options)) (*iam.ListOpenIDConnectProvidersOutput, error) {
+	out := &iam.ListOpenIDConnectProvidersOutput{}
+	for _, arn := range slices.Sorted(maps.Keys(c.providers)) {
+		out.OpenIDConnectProviderList = append(out.OpenIDConnectProviderList, iamtypes.OpenIDConnectProviderListEntry{Arn: aws.String(arn)})
+	}
+	return out, nil
+}
+
+func (c *fakeIam) GetOpenIDConnectProvider(_ context.Context, params *iam.GetOpenIDConnectProviderInput, _ ...func(*iam.Options)) (*iam.GetOpenIDConnectProviderOutput, error) {
+	arn := aws.ToString(params.OpenIDConnectProviderArn)
+	c.gets = append(c.gets, arn)
+	url, ok := c.providers[arn]
+	if !ok {
+		return nil, errors.Errorf("provider %s not found", arn)
+	}
+	return &iam.GetOpenIDConnectProviderOutput{
+		Url:            aws.String(url),
+		ClientIDList:   []string{"sts.amazonaws.com"},
+		ThumbprintList: []string{s3Thumbprint},
+	}, nil
+}
+
+func withIamClient(t *testing.T, client IamApi) {
+	t.Helper()
+	orig := getIamClient
+	getIamClient = func(aws.Config, string) IamApi { return client }
+	t.Cleanup(func() { getIamClient = orig })
+}
+
+func TestFindOpenIdProvider(t *testing.T) {
+	const (
+		issuer = "https://s3.eu-west-1.amazonaws.com/test-irsa"
+		url    = "s3.eu-west-1.amazonaws.com/test-irsa"
+		arn    = "arn:aws:iam::123456789012:oidc-provider/" + url
+	)
+
+	cases := map[string]struct {
+		providers map[string]string
+		want      string
+		wantGets  []string
+		wantErr   bool
+	}{
+		"Match": {
+			providers: map[string]string{arn: url},
+			want:      arn,
+			wantGets:  []string{arn},
+		},
+		"NoProviders": {
+			providers: map[string]string{},
+		},
+		"IssuerIsSuffixOfOtherURL": {
+			providers: map[string]string{
+				"arn:aws:iam::123456789012:oidc-provider/evil." + url: "evil." + url,
+			},
+		},
+		"IssuerIsPrefixOfOtherURL": {
+			providers: map[string]string{
+				"arn:aws:iam::123456789012:oidc-provider/" + url + "-other": url + "-other",
+			},
+		},
+		"OtherPartition": {
+			providers: map[string]string{
+				"arn:aws-cn:iam::123456789012:oidc-provider/" + url: url,
+			},
+		},
+		"URLMismatch": {
+			providers: map[string]string{arn: "s3.eu-west-1.amazonaws.com/other"},
+			wantGets:  []string{arn},
+		},
+		"Multiple": {
+			providers: map[string]string{
+				arn: url,
+				"arn:aws:iam::210987654321:oidc-provider/" + url: url,
+			},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			client := &fakeIam{providers: tc.providers}
+			withIamClient(t, client)
+
+			got, err := newTestAWSFunction("default", "eu-west-1").findOpenIdProvider(context.Background(), issuer, "eu-west-1", "default")
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("findOpenIdProvider() error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if tc.wantErr {
+				return
+			}
+
+			var gotArn string
+			if got != nil {
+				gotArn = got.Arn
+			}
+			if gotArn != tc.want {
+				t.Errorf("findOpenIdProvider() = %q, want %q", gotArn, tc.want)
+			}
+			if !slices.Equal(client.gets, tc.wantGets) {
+				t.Errorf("GetOpenIDConnectProvider() calls = %v, want %v", client.gets, tc.wantGets)
+			}
+		})
+	}
+}
+
+func TestPatchOpenIdProviderEmptyLists(t *testing.T) {
+	_, c := newTestComposition(map[string]any{})
+	provider := &OpenIdProvider{Arn: "arn:aws:iam::123456789012:oidc-provider/test"}
+
+	if err := newTestFunction().patchOpenIdProvider(provider, c); err != nil {
+		t.Fatalf("patchOpenIdProvider() error = %v", err)
+	}
+
+	for _, ref := range []string{openIdProviderThumbprintsRef, openIdProviderClientIdsRef} {
+		got, err := fieldpath.Pave(c.DesiredComposite.Resource.Object).GetValue(ref)
+		if err != nil {
+			t.Fatalf("GetValue(%q) error = %v", ref, err)
+		}
+		if list, ok := got.([]any); !ok || len(list) != 0 {
+			t.Errorf("%s = %#v, want an empty list", ref, got)
+		}
+	}
+}
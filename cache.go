@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+)
+
+type discoveryCacheEntry struct {
+	value   any
+	err     error
+	expires time.Time
+}
+
+// discoveryCache remembers the outcome of AWS discovery lookups so that
+// repeated reconciles of the same XR do not list every hosted zone,
+// distribution and OpenID Connect provider in the account again.
+//
+// Lookups that found nothing or failed are cached for the (usually shorter)
+// negative TTL, so that throttled or denied lookups are not retried on every
+// reconcile. Lookups cancelled or timed out by the caller are never cached. A
+// nil discoveryCache, or one with a TTL of zero, disables caching.
+type discoveryCache struct {
+	mu          sync.Mutex
+	ttl         time.Duration
+	negativeTTL time.Duration
+	entries     map[string]discoveryCacheEntry
+}
+
+func newDiscoveryCache(ttl, negativeTTL time.Duration) *discoveryCache {
+	return &discoveryCache{
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		entries:     make(map[string]discoveryCacheEntry),
+	}
+}
+
+// cachedLookup returns the cached value for the given service and key parts,
+// or calls fn to discover it. fn must return the zero value of T when nothing
+// was found.
+func cachedLookup[T comparable](c *discoveryCache, service string, fn func() (T, error), keyParts ...string) (value T, err error) {
+	var zero T
+	if c == nil || c.ttl <= 0 {
+		return fn()
+	}
+
+	key := service + "/" + strings.Join(keyParts, "/")
+	ts := now()
+
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	if ok && !ts.Before(entry.expires) {
+		delete(c.entries, key)
+		ok = false
+	}
+	c.mu.Unlock()
+
+	if ok {
+		value = entry.value.(T)
+		result := "hit"
+		switch {
+		case entry.err != nil:
+			result = "error_hit"
+		case value == zero:
+			result = "negative_hit"
+		}
+		discoveryCacheRequests.WithLabelValues(service, result).Inc()
+		return value, entry.err
+	}
+
+	discoveryCacheRequests.WithLabelValues(service, "miss").Inc()
+	value, err = fn()
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return
+	}
+
+	ttl := c.ttl
+	if value == zero || err != nil {
+		ttl = c.negativeTTL
+	}
+
+	if ttl > 0 {
+		c.mu.Lock()
+		c.entries[key] = discoveryCacheEntry{
+			value:   value,
+			err:     err,
+			expires: ts.Add(ttl),
+		}
+		c.mu.Unlock()
+	}
+	return
+}
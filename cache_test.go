@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+)
+
+// countingLookup returns a lookup returning value and err that counts its
+// calls
+func countingLookup(calls *int, value string, err error) func() (string, error) {
+	return func() (string, error) {
+		*calls++
+		return value, err
+	}
+}
+
+func TestCachedLookup(t *testing.T) {
+	var (
+		start       = time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+		ttl         = 10 * time.Minute
+		negativeTTL = time.Minute
+		errLookup   = errors.New("throttled")
+	)
+
+	type step struct {
+		after     time.Duration
+		wantCalls int
+	}
+
+	cases := map[string]struct {
+		cache   *discoveryCache
+		value   string
+		err     error
+		steps   []step
+		wantErr error
+	}{
+		"HitWithinTTL": {
+			cache: newDiscoveryCache(ttl, negativeTTL),
+			value: "Z123",
+			steps: []step{{0, 1}, {negativeTTL, 1}, {ttl - time.Second, 1}},
+		},
+		"MissAfterTTL": {
+			cache: newDiscoveryCache(ttl, negativeTTL),
+			value: "Z123",
+			steps: []step{{0, 1}, {ttl, 2}, {ttl + time.Second, 2}},
+		},
+		"NotFoundCachedForNegativeTTL": {
+			cache: newDiscoveryCache(ttl, negativeTTL),
+			steps: []step{{0, 1}, {negativeTTL - time.Second, 1}, {negativeTTL, 2}},
+		},
+		"ErrorCachedForNegativeTTL": {
+			cache:   newDiscoveryCache(ttl, negativeTTL),
+			err:     errLookup,
+			steps:   []step{{0, 1}, {negativeTTL - time.Second, 1}, {negativeTTL, 2}},
+			wantErr: errLookup,
+		},
+		"TimeoutNotCached": {
+			cache:   newDiscoveryCache(ttl, negativeTTL),
+			err:     context.DeadlineExceeded,
+			steps:   []step{{0, 1}, {0, 2}},
+			wantErr: context.DeadlineExceeded,
+		},
+		"ZeroNegativeTTL": {
+			cache: newDiscoveryCache(ttl, 0),
+			steps: []step{{0, 1}, {0, 2}},
+		},
+		"ZeroTTL": {
+			cache: newDiscoveryCache(0, negativeTTL),
+			value: "Z123",
+			steps: []step{{0, 1}, {0, 2}},
+		},
+		"NilCache": {
+			value: "Z123",
+			steps: []step{{0, 1}, {0, 2}},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			var calls int
+			lookup := countingLookup(&calls, tc.value, tc.err)
+
+			for i, s := range tc.steps {
+				withNow(t, start.Add(s.after))
+
+				got, err := cachedLookup(tc.cache, "route53", lookup, "default", "test.example.com")
+				if !errors.Is(err, tc.wantErr) || (err == nil) != (tc.wantErr == nil) {
+					t.Fatalf("step %d: cachedLookup() error = %v, want %v", i, err, tc.wantErr)
+				}
+				if got != tc.value {
+					t.Errorf("step %d: cachedLookup() = %q, want %q", i, got, tc.value)
+				}
+				if calls != s.wantCalls {
+					t.Errorf("step %d: lookups = %d, want %d", i, calls, s.wantCalls)
+				}
+			}
+		})
+	}
+}
+
+func TestCachedLookupKeys(t *testing.T) {
+	var calls int
+	c := newDiscoveryCache(time.Hour, time.Minute)
+	lookup := countingLookup(&calls, "Z123", nil)
+
+	for _, parts := range [][]string{{"default", "a.example.com"}, {"default", "b.example.com"}, {"other", "a.example.com"}, {"default", "a.example.com"}} {
+		if _, err := cachedLookup(c, "route53", lookup, parts...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := cachedLookup(c, "iam", lookup, "default", "a.example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	if calls != 4 {
+		t.Errorf("lookups = %d, want 4", calls)
+	}
+}
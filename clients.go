@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/smithy-go/middleware"
+	kclient "github.com/giantswarm/xfnlib/pkg/auth/kubernetes"
+	"golang.org/x/sync/singleflight"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// defaultAWSConfigTTL is how long a resolved AWS config is reused before the
+// ProviderConfig is read again.
+const defaultAWSConfigTTL = 15 * time.Minute
+
+// awsConfigLoadTimeout bounds a shared load of an AWS config, which is not
+// cancelled with the step that started it as other steps may be waiting on it.
+const awsConfigLoadTimeout = 30 * time.Second
+
+// credentialExpiryMargin is subtracted from the expiry of credentials so that
+// a config is never handed out with credentials about to expire.
+const credentialExpiryMargin = time.Minute
+
+var getKubeClient = kclient.Client
+
+type awsConfigEntry struct {
+	cfg      aws.Config
+	services map[string]string
+	expires  time.Time
+}
+
+// clientCache holds the Kubernetes client and the resolved AWS configs for
+// the lifetime of the process so they are not rebuilt on every call.
+//
+// A nil clientCache is valid and resolves everything on each call.
+type clientCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	kube    client.Client
+	configs map[string]*awsConfigEntry
+	loads   singleflight.Group
+}
+
+func newClientCache(ttl time.Duration) *clientCache {
+	if ttl <= 0 {
+		ttl = defaultAWSConfigTTL
+	}
+
+	return &clientCache{
+		ttl:     ttl,
+		configs: make(map[string]*awsConfigEntry),
+	}
+}
+
+// kubeClient returns the shared Kubernetes client, creating it on first use.
+func (f *Function) kubeClient() (c client.Client, err error) {
+	if f.clients == nil {
+		return getKubeClient()
+	}
+
+	f.clients.mu.Lock()
+	defer f.clients.mu.Unlock()
+
+	if f.clients.kube == nil {
+		if f.clients.kube, err = getKubeClient(); err != nil {
+			return
+		}
+	}
+
+	return f.clients.kube, nil
+}
+
+// getAWSConfig returns the AWS config for the given region and ProviderConfig.
+//
+// Configs are cached per ProviderConfig and region until either the cache TTL
+// passes or the retrieved credentials expire, whichever happens first.
+// Concurrent requests for the same key share a single load, which each caller
+// stops waiting for once its own context is done.
+func (f *Function) getAWSConfig(ctx context.Context, region, providerConfigRef string) (cfg aws.Config, services map[string]string, err error) {
+	if f.clients == nil {
+		if cfg, services, err = awsConfig(&region, &providerConfigRef, f.log); err != nil {
+			return
+		}
+		return f.withAccountLimits(withTelemetry(cfg), services, providerConfigRef), services, nil
+	}
+
+	key := providerConfigRef + "/" + region
+
+	f.clients.mu.Lock()
+	entry, ok := f.clients.configs[key]
+	f.clients.mu.Unlock()
+
+	if ok && now().Before(entry.expires) {
+		return entry.cfg, entry.services, nil
+	}
+
+	loaded := f.clients.loads.DoChan(key, func() (any, error) {
+		loadCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), awsConfigLoadTimeout)
+		defer cancel()
+		return f.loadAWSConfig(loadCtx, key, region, providerConfigRef)
+	})
+
+	select {
+	case <-ctx.Done():
+		err = ctx.Err()
+		return
+	case res := <-loaded:
+		if err = res.Err; err != nil {
+			return
+		}
+		entry = res.Val.(*awsConfigEntry)
+		return entry.cfg, entry.services, nil
+	}
+}
+
+func (f *Function) loadAWSConfig(ctx context.Context, key, region, providerConfigRef string) (*awsConfigEntry, error) {
+	f.log.Debug("Loading AWS config", "providerConfig", providerConfigRef, "region", region)
+
+	cfg, services, err := awsConfig(&region, &providerConfigRef, f.log)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &awsConfigEntry{
+		cfg:      f.withAccountLimits(withTelemetry(cfg), services, providerConfigRef),
+		services: services,
+		expires:  now().Add(f.clients.ttl),
+	}
+
+	if cfg.Credentials != nil {
+		creds, cerr := cfg.Credentials.Retrieve(ctx)
+		if cerr != nil {
+			// Don't cache a config we cannot get credentials for, the caller
+			// will receive the same error from the first API call.
+			f.log.Debug("cannot retrieve AWS credentials", "error", cerr)
+			return entry, nil
+		}
+
+		if expires := creds.Expires.Add(-credentialExpiryMargin); creds.CanExpire && expires.Before(entry.expires) {
+			entry.expires = expires
+		}
+	}
+
+	f.clients.mu.Lock()
+	f.clients.configs[key] = entry
+	f.clients.mu.Unlock()
+
+	return entry, nil
+}
+
+// withAPIOptions returns a copy of the config with the options appended,
+// leaving the options of the config the caller holds unchanged
+func withAPIOptions(cfg aws.Config, options ...func(*middleware.Stack) error) aws.Config {
+	cfg.APIOptions = append(cfg.APIOptions[:len(cfg.APIOptions):len(cfg.APIOptions)], options...)
+	return cfg
+}
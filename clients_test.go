@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+)
+
+func withAWSConfig(t *testing.T, fn func(region, providerCfgRef *string, log logging.Logger) (aws.Config, map[string]string, error)) {
+	t.Helper()
+	orig := awsConfig
+	awsConfig = fn
+	t.Cleanup(func() { awsConfig = orig })
+}
+
+// TestGetAWSConfigSharedLoad ensures that a caller giving up on a shared load
+// does not fail the other callers waiting for it
+func TestGetAWSConfigSharedLoad(t *testing.T) {
+	var (
+		loads   atomic.Int32
+		started = make(chan struct{})
+		release = make(chan struct{})
+	)
+	withAWSConfig(t, func(region, _ *string, _ logging.Logger) (aws.Config, map[string]string, error) {
+		if loads.Add(1) == 1 {
+			close(started)
+		}
+		<-release
+
+		// Credentials are retrieved with the context of the load
+		credentials := aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret"}, ctx.Err()
+		})
+		return aws.Config{Region: *region, Credentials: credentials}, map[string]string{}, nil
+	})
+
+	f := newTestFunction()
+	f.clients = newClientCache(0)
+
+	first, cancel := context.WithCancel(context.Background())
+	firstErr := make(chan error, 1)
+	go func() {
+		_, _, err := f.getAWSConfig(first, "eu-west-1", "default")
+		firstErr <- err
+	}()
+	<-started
+
+	secondErr := make(chan error, 1)
+	go func() {
+		cfg, _, err := f.getAWSConfig(context.Background(), "eu-west-1", "default")
+		if err == nil && cfg.Region != "eu-west-1" {
+			err = errors.New("unexpected region " + cfg.Region)
+		}
+		secondErr <- err
+	}()
+
+	cancel()
+	select {
+	case err := <-firstErr:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("getAWSConfig() error = %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("getAWSConfig() kept waiting after its context was cancelled")
+	}
+
+	close(release)
+	select {
+	case err := <-secondErr:
+		if err != nil {
+			t.Errorf("getAWSConfig() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("getAWSConfig() did not return")
+	}
+
+	// The load was not cut short, so its result was cached
+	if _, _, err := f.getAWSConfig(context.Background(), "eu-west-1", "default"); err != nil {
+		t.Fatalf("getAWSConfig() error = %v", err)
+	}
+	if n := loads.Load(); n != 1 {
+		t.Errorf("awsConfig() called %d times, want 1", n)
+	}
+}
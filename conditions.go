@@ -0,0 +1,86 @@
+package main
+
+import (
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/response"
+)
+
+// Condition types set on the composite resource
+const (
+	// conditionHostedZoneDiscovered reports the outcome of the Route53 hosted
+	// zone lookup
+	conditionHostedZoneDiscovered = "HostedZoneDiscovered"
+
+	// conditionDistributionDiscovered reports the outcome of the CloudFront
+	// distribution lookup
+	conditionDistributionDiscovered = "DistributionDiscovered"
+
+	// conditionOIDCProviderDiscovered reports the outcome of the IAM OpenID
+	// Connect provider lookup
+	conditionOIDCProviderDiscovered = "OIDCProviderDiscovered"
+
+	// conditionDiscoveryDocumentGenerated reports whether the OIDC discovery
+	// document was generated
+	conditionDiscoveryDocumentGenerated = "DiscoveryDocumentGenerated"
+
+	// conditionKeysGenerated reports whether the service account signing key
+	// could be read and published as JWKS
+	conditionKeysGenerated = "KeysGenerated"
+)
+
+// Condition reasons
+const (
+	// reasonFound is used when a resource was found in AWS
+	reasonFound = "Found"
+
+	// reasonReused is used when discovery was skipped and the value recorded
+	// on the XR is reused
+	reasonReused = "Reused"
+
+	// reasonNotFound is used when the lookup succeeded without a match
+	reasonNotFound = "NotFound"
+
+	// reasonLookupFailed is used when the lookup itself failed
+	reasonLookupFailed = "LookupFailed"
+
+	// reasonNotRequired is used when the issuer mode does not need the step
+	reasonNotRequired = "NotRequired"
+
+	// reasonThumbprintUnknown is used when the issuer thumbprint can neither
+	// be computed nor looked up for the partition
+	reasonThumbprintUnknown = "ThumbprintUnknown"
+
+	reasonGenerated        = "Generated"
+	reasonGenerationFailed = "GenerationFailed"
+
+	reasonSecretNotResolved = "SecretNotResolved"
+	reasonSecretNotFound    = "SecretNotFound"
+	reasonSecretUnavailable = "SecretUnavailable"
+	reasonKeyNotFound       = "KeyNotFound"
+	reasonKeyParseError     = "KeyParseError"
+)
+
+// ServiceAccountKeyError is raised when the service account signing key cannot
+// be loaded. Reason is used as the reason of the KeysGenerated condition.
+type ServiceAccountKeyError struct {
+	Reason string
+	Err    error
+}
+
+func (e *ServiceAccountKeyError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ServiceAccountKeyError) Unwrap() error {
+	return e.Err
+}
+
+// setCondition sets a condition on the composite resource and its claim
+func setCondition(rsp *fnv1.RunFunctionResponse, typ string, ok bool, reason, message string) {
+	condition, status := response.ConditionFalse, "False"
+	if ok {
+		condition, status = response.ConditionTrue, "True"
+	}
+	condition(rsp, typ, reason).WithMessage(message).TargetCompositeAndClaim()
+	stepOutcomes.WithLabelValues(typ, status, reason).Inc()
+}
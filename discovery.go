@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+	"github.com/crossplane/crossplane-runtime/pkg/fieldpath"
+	"github.com/crossplane/function-sdk-go/resource"
+	"github.com/giantswarm/xfnlib/pkg/composite"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/giantswarm/crossplane-fn-irsa/pkg/input/v1beta1"
+)
+
+const (
+	// rediscoverAnnotation forces discovery to run on the next reconcile when
+	// set to "true" on the XR
+	rediscoverAnnotation = "irsa.fn.giantswarm.io/rediscover"
+
+	distributionIdRef    = "status.importResources.cloudfrontDistributionId"
+	openIdProviderArnRef = "status.importResources.openIdProviderArn"
+
+	openIdProviderThumbprintsRef = "status.importResources.openIdProviderThumbprints"
+	openIdProviderClientIdsRef   = "status.importResources.openIdProviderClientIds"
+
+	lastDiscoveryTimeRef = "status.importResources.lastDiscoveryTime"
+)
+
+// shouldRediscover reports whether all discovery steps need to run,
+// regardless of any values already recorded on the observed XR.
+func (f *Function) shouldRediscover(spec *v1beta1.Spec, oxr *resource.Composite) bool {
+	if spec.DiscoveryPolicy != v1beta1.DiscoveryPolicyIfMissing {
+		return true
+	}
+
+	if oxr.Resource.GetAnnotations()[rediscoverAnnotation] == "true" {
+		f.log.Debug("Rediscovery requested by annotation", "annotation", rediscoverAnnotation)
+		return true
+	}
+
+	if spec.DiscoveryRefreshInterval == nil || spec.DiscoveryRefreshInterval.Duration <= 0 {
+		return false
+	}
+
+	last, err := f.getStringFromPaved(oxr.Resource, lastDiscoveryTimeRef)
+	if err != nil {
+		return true
+	}
+
+	lastDiscovery, err := time.Parse(time.RFC3339, last)
+	if err != nil {
+		f.log.Debug("Invalid last discovery time", "time", last, "error", err)
+		return true
+	}
+
+	return now().Sub(lastDiscovery) >= spec.DiscoveryRefreshInterval.Duration
+}
+
+// carryForward copies a previously discovered value from the observed to the
+// desired XR. It returns false if no value is recorded, in which case the
+// value needs to be discovered.
+func (f *Function) carryForward(ref string, oxr *resource.Composite, composed *composite.Composition) bool {
+	var (
+		paved *fieldpath.Paved
+		value any
+		err   error
+	)
+
+	if paved, err = fieldpath.PaveObject(oxr.Resource); err != nil {
+		return false
+	}
+
+	if value, err = paved.GetValue(ref); err != nil || value == nil || value == "" {
+		return false
+	}
+
+	if err = f.patchFieldValueToObject(ref, value, composed.DesiredComposite.Resource); err != nil {
+		f.log.Info("Failed to carry forward discovered value", "ref", ref, "error", err)
+		return false
+	}
+
+	f.log.Debug("Reusing previously discovered value", "ref", ref, "value", value)
+	return true
+}
+
+// recordDiscovery stamps the time of a full discovery onto the desired XR, or
+// carries the previous time forward if discovery was skipped. The time is
+// only read by the IfMissing policy and is not stamped otherwise, as it would
+// change the XR on every reconcile.
+func (f *Function) recordDiscovery(spec *v1beta1.Spec, rediscovered bool, oxr *resource.Composite, composed *composite.Composition) error {
+	if !rediscovered || spec.DiscoveryPolicy != v1beta1.DiscoveryPolicyIfMissing {
+		f.carryForward(lastDiscoveryTimeRef, oxr, composed)
+		return nil
+	}
+
+	return f.patchFieldValueToObject(lastDiscoveryTimeRef, now().UTC().Format(time.RFC3339), composed.DesiredComposite.Resource)
+}
+
+// hostedZoneOptions resolves the hosted zone discovery options of the input
+// against the observed XR.
+func (f *Function) hostedZoneOptions(spec *v1beta1.HostedZoneDiscovery, oxr *resource.Composite) (opts HostedZoneOptions, err error) {
+	if spec == nil {
+		return
+	}
+
+	opts = HostedZoneOptions{
+		Prefer:           spec.Prefer,
+		Tags:             spec.Tags,
+		FallbackToParent: spec.FallbackToParent,
+	}
+
+	if spec.VPCIDRef != "" {
+		if opts.VPCID, err = f.getStringFromPaved(oxr.Resource, spec.VPCIDRef); err != nil {
+			err = errors.Wrapf(err, "cannot get VPC ID from %q", spec.VPCIDRef)
+		}
+	}
+	return
+}
+
+// serviceProviderConfig returns the ProviderConfig read from ref on the XR,
+// or the fallback when ref is unset or holds no value.
+func (f *Function) serviceProviderConfig(ref, fallback string, oxr *resource.Composite) string {
+	if ref == "" {
+		return fallback
+	}
+
+	providerConfig, err := f.getStringFromPaved(oxr.Resource, ref)
+	if err != nil || providerConfig == "" {
+		f.log.Debug("Using default provider config", "ref", ref, "providerConfig", fallback)
+		return fallback
+	}
+
+	return providerConfig
+}
+
+// discoveryStep is a lookup run concurrently with the other discovery steps
+type discoveryStep struct {
+	name    string
+	timeout time.Duration
+
+	// run performs the lookup. It must not modify the composition.
+	run func(ctx context.Context) error
+
+	// apply patches the result of a successful lookup to the composition
+	apply func() error
+
+	err      error
+	timedOut bool
+}
+
+// runDiscovery runs the steps with at most limit of them at a time, or all at
+// once if limit is not positive. A failing step does not cancel the others.
+// Once all steps finished, the results of the successful ones are applied in
+// the order of the steps.
+func runDiscovery(ctx context.Context, limit int, steps []*discoveryStep) {
+	var g errgroup.Group
+	if limit > 0 {
+		g.SetLimit(limit)
+	}
+
+	for _, step := range steps {
+		g.Go(func() error {
+			stepCtx, done := startStep(ctx, step.name, step.timeout)
+			step.err = step.run(stepCtx)
+			step.timedOut = isTimeout(stepCtx, step.err)
+			done(step.err)
+			return nil
+		})
+	}
+	_ = g.Wait()
+
+	for _, step := range steps {
+		if step.err == nil && step.apply != nil {
+			step.err = step.apply()
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+	"github.com/crossplane/crossplane-runtime/pkg/fieldpath"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/giantswarm/crossplane-fn-irsa/pkg/input/v1beta1"
+)
+
+// reconcileDiscovery runs discovery bookkeeping for an XR as observed and
+// returns the desired XR
+func reconcileDiscovery(t *testing.T, spec *v1beta1.Spec, observed map[string]any) map[string]any {
+	t.Helper()
+
+	f := newTestFunction()
+	oxr, c := newTestComposition(observed)
+	if err := f.recordDiscovery(spec, f.shouldRediscover(spec, oxr), oxr, c); err != nil {
+		t.Fatalf("recordDiscovery() error = %v", err)
+	}
+	return c.DesiredComposite.Resource.Object
+}
+
+func lastDiscoveryTime(obj map[string]any) string {
+	value, _ := fieldpath.Pave(obj).GetString(lastDiscoveryTimeRef)
+	return value
+}
+
+func TestRecordDiscoveryAlways(t *testing.T) {
+	spec := &v1beta1.Spec{DiscoveryPolicy: v1beta1.DiscoveryPolicyAlways}
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	withNow(t, start)
+	desired := reconcileDiscovery(t, spec, nil)
+	if got := lastDiscoveryTime(desired); got != "" {
+		t.Fatalf("first reconcile set %s to %q, want it unset", lastDiscoveryTimeRef, got)
+	}
+
+	// A time recorded under IfMissing before the policy changed is kept
+	recorded := start.Add(-time.Hour).Format(time.RFC3339)
+	observed := map[string]any{"status": map[string]any{"importResources": map[string]any{"lastDiscoveryTime": recorded}}}
+
+	withNow(t, start.Add(time.Minute))
+	if got := lastDiscoveryTime(reconcileDiscovery(t, spec, observed)); got != recorded {
+		t.Errorf("second reconcile set %s to %q, want %q", lastDiscoveryTimeRef, got, recorded)
+	}
+}
+
+func TestRecordDiscoveryIfMissing(t *testing.T) {
+	spec := &v1beta1.Spec{
+		DiscoveryPolicy:          v1beta1.DiscoveryPolicyIfMissing,
+		DiscoveryRefreshInterval: &metav1.Duration{Duration: time.Hour},
+	}
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	// Nothing recorded yet, so discovery runs and is stamped
+	withNow(t, start)
+	desired := reconcileDiscovery(t, spec, nil)
+	if got, want := lastDiscoveryTime(desired), start.Format(time.RFC3339); got != want {
+		t.Fatalf("first reconcile set %s to %q, want %q", lastDiscoveryTimeRef, got, want)
+	}
+
+	// Within the refresh interval discovery is skipped and the time kept
+	withNow(t, start.Add(30*time.Minute))
+	if got, want := lastDiscoveryTime(reconcileDiscovery(t, spec, desired)), start.Format(time.RFC3339); got != want {
+		t.Errorf("reconcile within the interval set %s to %q, want %q", lastDiscoveryTimeRef, got, want)
+	}
+
+	// Once it passed discovery runs again
+	refreshed := start.Add(time.Hour)
+	withNow(t, refreshed)
+	if got, want := lastDiscoveryTime(reconcileDiscovery(t, spec, desired)), refreshed.Format(time.RFC3339); got != want {
+		t.Errorf("reconcile after the interval set %s to %q, want %q", lastDiscoveryTimeRef, got, want)
+	}
+}
+
+func TestRunDiscovery(t *testing.T) {
+	const limit = 2
+
+	var (
+		mu      sync.Mutex
+		applied []string
+
+		running, maxRunning atomic.Int32
+	)
+
+	step := func(name string, delay time.Duration, err error) *discoveryStep {
+		return &discoveryStep{
+			name: name,
+			run: func(context.Context) error {
+				n := running.Add(1)
+				defer running.Add(-1)
+				for {
+					m := maxRunning.Load()
+					if n <= m || maxRunning.CompareAndSwap(m, n) {
+						break
+					}
+				}
+				time.Sleep(delay)
+				return err
+			},
+			apply: func() error {
+				mu.Lock()
+				defer mu.Unlock()
+				applied = append(applied, name)
+				return nil
+			},
+		}
+	}
+
+	// Earlier steps take longer, so that they finish last
+	steps := []*discoveryStep{
+		step("first", 40*time.Millisecond, nil),
+		step("second", 30*time.Millisecond, errors.New("second failed")),
+		step("third", 20*time.Millisecond, nil),
+		step("fourth", 10*time.Millisecond, errors.New("fourth failed")),
+		step("fifth", 0, nil),
+	}
+
+	runDiscovery(context.Background(), limit, steps)
+
+	if want := []string{"first", "third", "fifth"}; !slices.Equal(applied, want) {
+		t.Errorf("applied = %v, want %v", applied, want)
+	}
+	for _, s := range steps {
+		wantErr := s.name == "second" || s.name == "fourth"
+		if (s.err != nil) != wantErr {
+			t.Errorf("step %s error = %v, want error %v", s.name, s.err, wantErr)
+		}
+		if s.timedOut {
+			t.Errorf("step %s timed out", s.name)
+		}
+	}
+	if got := maxRunning.Load(); got > limit {
+		t.Errorf("concurrent steps = %d, want at most %d", got, limit)
+	}
+}
+
+func TestRunDiscoveryTimeout(t *testing.T) {
+	var applied bool
+	steps := []*discoveryStep{
+		{
+			name:    "slow",
+			timeout: time.Millisecond,
+			run: func(ctx context.Context) error {
+				<-ctx.Done()
+				return ctx.Err()
+			},
+			apply: func() error {
+				applied = true
+				return nil
+			},
+		},
+		{
+			name: "failing",
+			run:  func(context.Context) error { return nil },
+			apply: func() error {
+				return errors.New("cannot patch result")
+			},
+		},
+	}
+
+	runDiscovery(context.Background(), 0, steps)
+
+	if !steps[0].timedOut || !errors.Is(steps[0].err, context.DeadlineExceeded) || applied {
+		t.Errorf("slow step timedOut = %v, error = %v, applied = %v, want a timeout that is not applied", steps[0].timedOut, steps[0].err, applied)
+	}
+	if steps[1].err == nil || steps[1].timedOut {
+		t.Errorf("failing step error = %v, timedOut = %v, want the apply error", steps[1].err, steps[1].timedOut)
+	}
+}
@@ -2,11 +2,13 @@ package main
 
 import (
 	"context"
-	"strings"
+	"crypto"
+	"time"
 
 	"github.com/crossplane/crossplane-runtime/pkg/errors"
 	"github.com/crossplane/crossplane-runtime/pkg/fieldpath"
 	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"go.opentelemetry.io/otel/attribute"
 
 	"github.com/crossplane/function-sdk-go/request"
 	"github.com/crossplane/function-sdk-go/response"
@@ -20,8 +22,16 @@ import (
 const composedName = "crossplane-fn-irsa"
 
 // RunFunction Execute the desired reconcilliation state, creating any required resources
-func (f *Function) RunFunction(_ context.Context, req *fnv1.RunFunctionRequest) (rsp *fnv1.RunFunctionResponse, err error) {
+func (f *Function) RunFunction(ctx context.Context, req *fnv1.RunFunctionRequest) (rsp *fnv1.RunFunctionResponse, err error) {
 	rsp = response.To(req, response.DefaultTTL)
+	ctx, cancel := withRequestDeadline(ctx)
+	defer cancel()
+
+	ctx, span := tracer.Start(ctx, "RunFunction")
+	defer func(start time.Time) {
+		observeRun(start, rsp)
+		endRunSpan(span, rsp)
+	}(time.Now())
 
 	var (
 		composed       *composite.Composition
@@ -38,6 +48,10 @@ func (f *Function) RunFunction(_ context.Context, req *fnv1.RunFunctionRequest)
 		response.Fatal(rsp, errors.Wrap(err, "cannot get observed composite resource"))
 		return rsp, nil
 	}
+	span.SetAttributes(
+		attribute.String("irsa.xr.kind", oxr.Resource.GetKind()),
+		attribute.String("irsa.xr.name", oxr.Resource.GetName()),
+	)
 
 	if composed, err = composite.New(req, &input, &oxr); err != nil {
 		response.Fatal(rsp, errors.Wrap(err, "error setting up function "+composedName))
@@ -49,6 +63,15 @@ func (f *Function) RunFunction(_ context.Context, req *fnv1.RunFunctionRequest)
 		return rsp, nil
 	}
 
+	// In dry run mode the desired state is snapshotted so that changes can
+	// be reported and reverted at the end
+	var dryRun *plan
+	if f.isDryRun(input.Spec, oxr) {
+		f.log.Info("Dry run, changes will be reported but not applied")
+		dryRun = newPlan(composed)
+		defer dryRun.quiet(rsp)
+	}
+
 	// Extract region and provider config from input
 	if region, err = f.getStringFromPaved(oxr.Resource, input.Spec.RegionRef); err != nil {
 		response.Fatal(rsp, errors.Wrapf(err, "cannot get region from %q", input.Spec.RegionRef))
@@ -69,7 +92,33 @@ func (f *Function) RunFunction(_ context.Context, req *fnv1.RunFunctionRequest)
 	}
 	f.log.Debug("ProviderConfig", "providerConfig", providerConfig)
 
-	if !strings.HasPrefix(region, "cn-") {
+	dnsProviderConfig := f.serviceProviderConfig(input.Spec.DNSProviderConfigRef, providerConfig, oxr)
+	cloudFrontProviderConfig := f.serviceProviderConfig(input.Spec.CloudFrontProviderConfigRef, providerConfig, oxr)
+	iamProviderConfig := f.serviceProviderConfig(input.Spec.IAMProviderConfigRef, providerConfig, oxr)
+	f.log.Debug("Service ProviderConfigs", "dns", dnsProviderConfig, "cloudfront", cloudFrontProviderConfig, "iam", iamProviderConfig)
+
+	rediscover := f.shouldRediscover(input.Spec, oxr)
+	partition := PartitionForRegion(region)
+	f.log.Debug("Partition", "partition", partition.ID)
+
+	var mode v1beta1.IssuerMode
+	if mode, err = ResolveIssuerMode(input.Spec.IssuerMode, partition); err != nil {
+		response.Fatal(rsp, errors.Wrap(err, "cannot resolve issuer mode"))
+		return rsp, nil
+	}
+	f.log.Debug("IssuerMode", "mode", mode)
+
+	var customIssuer string
+	if mode == v1beta1.IssuerModeCustom {
+		if customIssuer, err = f.getStringFromPaved(oxr.Resource, input.Spec.CustomIssuerURLRef); err != nil {
+			response.Fatal(rsp, errors.Wrapf(err, "cannot get custom issuer URL from %q", input.Spec.CustomIssuerURLRef))
+			return rsp, nil
+		}
+	}
+
+	// Route53 and CloudFront are only involved when the issuer is served on
+	// the cluster domain
+	if mode == v1beta1.IssuerModeCloudFront {
 		if domain, err = f.getStringFromPaved(oxr.Resource, input.Spec.DomainRef); err != nil {
 			response.Fatal(rsp, errors.Wrapf(err, "cannot get domain from %q", input.Spec.DomainRef))
 			return rsp, nil
@@ -77,44 +126,338 @@ func (f *Function) RunFunction(_ context.Context, req *fnv1.RunFunctionRequest)
 		f.log.Debug("Domain", "domain", domain)
 
 		irsaDomain = "irsa." + domain
+	}
+
+	var issuer string
+	if issuer, err = IssuerURL(mode, irsaDomain, S3BucketName, region, customIssuer); err != nil {
+		response.Fatal(rsp, errors.Wrap(err, "cannot determine issuer URL"))
+		return rsp, nil
+	}
+	f.log.Debug("Issuer", "issuer", issuer)
 
-		if err = f.DiscoverHostedZone(domain, region, providerConfig, input.Spec.Route53HostedZonePatchToRef, composed); err != nil {
-			response.Fatal(rsp, errors.Wrapf(err, "cannot discover hosted zone for domain %q", domain))
+	if err = f.PublishIssuer(issuer, mode, input.Spec, composed); err != nil {
+		response.Fatal(rsp, err)
+		return rsp, nil
+	}
+
+	var thumbprint string
+	if input.Spec.Thumbprint != nil {
+		stepCtx, done := startStep(ctx, "thumbprint", f.stepTimeout(input.Spec.Timeouts, "thumbprint"))
+		if dryRun != nil {
+			thumbprint, err = f.DryRunThumbprint(stepCtx, issuer, mode, partition, input.Spec.Thumbprint, oxr, composed)
+		} else {
+			thumbprint, err = f.IssuerThumbprint(stepCtx, issuer, mode, partition, input.Spec.Thumbprint, oxr, composed)
+		}
+		done(err)
+		if isTimeout(stepCtx, err) {
+			warnTimeout(rsp, err)
+			thumbprint = f.keepThumbprint(input.Spec.Thumbprint, oxr, composed)
+		} else if errors.Is(err, errNoKnownThumbprint) {
+			// Partitions without a known thumbprint must not block the
+			// provider, IAM does not use the thumbprint of most issuers
+			response.Warning(rsp, err).WithReason(reasonThumbprintUnknown).TargetCompositeAndClaim()
+			thumbprint = f.keepThumbprint(input.Spec.Thumbprint, oxr, composed)
+		} else if err != nil {
+			response.Fatal(rsp, err)
 			return rsp, nil
 		}
+	}
 
-		if err = f.DiscoverDistribution(irsaDomain, region, providerConfig, composed); err != nil {
-			response.Fatal(rsp, errors.Wrapf(err, "cannot discover distribution resources for domain %q", domain))
-			return rsp, nil
+	// The hosted zone, distribution and OpenID Connect provider lookups are
+	// independent of each other and run concurrently
+	var (
+		hostedZone, distribution, oidcProvider *discoveryStep
+		steps                                  []*discoveryStep
+	)
+
+	if mode == v1beta1.IssuerModeCloudFront {
+		if rediscover || !f.carryForward(input.Spec.Route53HostedZonePatchToRef, oxr, composed) {
+			var opts HostedZoneOptions
+			if opts, err = f.hostedZoneOptions(input.Spec.HostedZoneDiscovery, oxr); err != nil {
+				response.Fatal(rsp, errors.Wrap(err, "cannot get hosted zone discovery options"))
+				return rsp, nil
+			}
+
+			var hostedZoneId string
+			hostedZone = &discoveryStep{
+				name:    "hosted_zone",
+				timeout: f.stepTimeout(input.Spec.Timeouts, "hosted_zone"),
+				run: func(ctx context.Context) (err error) {
+					hostedZoneId, err = f.DiscoverHostedZone(ctx, domain, region, dnsProviderConfig, opts)
+					return
+				},
+				apply: func() error {
+					return f.patchFieldValueToObject(input.Spec.Route53HostedZonePatchToRef, hostedZoneId, composed.DesiredComposite.Resource)
+				},
+			}
+			steps = append(steps, hostedZone)
+		}
+
+		if rediscover || !f.carryForward(distributionIdRef, oxr, composed) {
+			var distributionId string
+			distribution = &discoveryStep{
+				name:    "distribution",
+				timeout: f.stepTimeout(input.Spec.Timeouts, "distribution"),
+				run: func(ctx context.Context) (err error) {
+					distributionId, err = f.DiscoverDistribution(ctx, irsaDomain, region, cloudFrontProviderConfig)
+					return
+				},
+				apply: func() error {
+					if distributionId == "" {
+						return nil
+					}
+					return f.patchFieldValueToObject(distributionIdRef, distributionId, composed.DesiredComposite.Resource)
+				},
+			}
+			steps = append(steps, distribution)
 		}
 	}
 
-	// if in china regions
-	if strings.HasPrefix(region, "cn-") {
-		if err = f.DiscoverOpenIdProvider(S3BucketName, region, providerConfig, composed); err != nil {
-			response.Fatal(rsp, errors.Wrapf(err, "cannot discover open id provider for domain %q", domain))
-			return rsp, nil
+	if rediscover || !f.carryForward(openIdProviderArnRef, oxr, composed) {
+		var provider *OpenIdProvider
+		oidcProvider = &discoveryStep{
+			name:    "oidc_provider",
+			timeout: f.stepTimeout(input.Spec.Timeouts, "oidc_provider"),
+			run: func(ctx context.Context) (err error) {
+				provider, err = f.DiscoverOpenIdProvider(ctx, issuer, region, iamProviderConfig)
+				return
+			},
+			apply: func() error {
+				return f.patchOpenIdProvider(provider, composed)
+			},
 		}
+		steps = append(steps, oidcProvider)
+	}
+
+	runDiscovery(ctx, f.concurrency, steps)
+
+	// Every step reports its outcome before failures are returned together
+	var (
+		failed   []error
+		timedOut bool
+	)
+
+	if mode != v1beta1.IssuerModeCloudFront {
+		message := "Issuer mode " + string(mode) + " does not use Route53 or CloudFront"
+		setCondition(rsp, conditionHostedZoneDiscovered, true, reasonNotRequired, message)
+		setCondition(rsp, conditionDistributionDiscovered, true, reasonNotRequired, message)
 	} else {
-		if err = f.DiscoverOpenIdProvider(irsaDomain, region, providerConfig, composed); err != nil {
-			response.Fatal(rsp, errors.Wrapf(err, "cannot discover open id provider for domain %q", domain))
-			return rsp, nil
+		switch {
+		case hostedZone == nil:
+			setCondition(rsp, conditionHostedZoneDiscovered, true, reasonReused,
+				"Reusing hosted zone "+f.desiredString(input.Spec.Route53HostedZonePatchToRef, composed))
+		case hostedZone.err != nil:
+			err = errors.Wrapf(hostedZone.err, "cannot discover hosted zone for domain %q", domain)
+			if hostedZone.timedOut {
+				timedOut = true
+				setCondition(rsp, conditionHostedZoneDiscovered, false, reasonTimedOut, err.Error())
+				warnTimeout(rsp, err)
+				f.carryForward(input.Spec.Route53HostedZonePatchToRef, oxr, composed)
+				break
+			}
+
+			reason := reasonLookupFailed
+			if errors.Is(err, errHostedZoneNotFound) {
+				reason = reasonNotFound
+			}
+			setCondition(rsp, conditionHostedZoneDiscovered, false, reason, err.Error())
+			failed = append(failed, err)
+		default:
+			setCondition(rsp, conditionHostedZoneDiscovered, true, reasonFound,
+				"Found hosted zone "+f.desiredString(input.Spec.Route53HostedZonePatchToRef, composed)+" for domain "+domain)
+		}
+
+		switch {
+		case distribution == nil:
+			setCondition(rsp, conditionDistributionDiscovered, true, reasonReused,
+				"Reusing distribution "+f.desiredString(distributionIdRef, composed))
+		case distribution.err != nil:
+			err = errors.Wrapf(distribution.err, "cannot discover distribution resources for domain %q", domain)
+			if distribution.timedOut {
+				timedOut = true
+				setCondition(rsp, conditionDistributionDiscovered, false, reasonTimedOut, err.Error())
+				warnTimeout(rsp, err)
+				f.carryForward(distributionIdRef, oxr, composed)
+				break
+			}
+
+			setCondition(rsp, conditionDistributionDiscovered, false, reasonLookupFailed, err.Error())
+			failed = append(failed, err)
+		default:
+			if id := f.desiredString(distributionIdRef, composed); id != "" {
+				setCondition(rsp, conditionDistributionDiscovered, true, reasonFound, "Found distribution "+id+" for "+irsaDomain)
+			} else {
+				setCondition(rsp, conditionDistributionDiscovered, false, reasonNotFound, "No distribution found for "+irsaDomain+", a new one will be created")
+			}
+		}
+	}
+
+	switch {
+	case oidcProvider == nil:
+		f.carryForward(openIdProviderThumbprintsRef, oxr, composed)
+		f.carryForward(openIdProviderClientIdsRef, oxr, composed)
+		setCondition(rsp, conditionOIDCProviderDiscovered, true, reasonReused,
+			"Reusing OpenID Connect provider "+f.desiredString(openIdProviderArnRef, composed))
+	case oidcProvider.err != nil:
+		err = errors.Wrapf(oidcProvider.err, "cannot discover open id provider for issuer %q", issuer)
+		if oidcProvider.timedOut {
+			timedOut = true
+			setCondition(rsp, conditionOIDCProviderDiscovered, false, reasonTimedOut, err.Error())
+			warnTimeout(rsp, err)
+			f.carryForward(openIdProviderArnRef, oxr, composed)
+			f.carryForward(openIdProviderThumbprintsRef, oxr, composed)
+			f.carryForward(openIdProviderClientIdsRef, oxr, composed)
+			break
+		}
+
+		setCondition(rsp, conditionOIDCProviderDiscovered, false, reasonLookupFailed, err.Error())
+		failed = append(failed, err)
+	default:
+		if arn := f.desiredString(openIdProviderArnRef, composed); arn != "" {
+			setCondition(rsp, conditionOIDCProviderDiscovered, true, reasonFound, "Found OpenID Connect provider "+arn)
+		} else {
+			setCondition(rsp, conditionOIDCProviderDiscovered, false, reasonNotFound, "No OpenID Connect provider found for "+issuer+", a new one will be created")
 		}
 	}
 
-	if err = f.GenerateDiscoveryFile(irsaDomain, S3BucketName, region, input.Spec.S3DiscoveryPatchToRef, composed); err != nil {
-		response.Fatal(rsp, errors.Wrapf(err, "cannot generate discovery file for domain %q", domain))
+	if len(failed) > 0 {
+		response.Fatal(rsp, errors.Join(failed...))
+		return rsp, nil
+	}
+
+	// A discovery that timed out is not recorded, so that it runs again
+	if err = f.recordDiscovery(input.Spec, rediscover && !timedOut, oxr, composed); err != nil {
+		response.Fatal(rsp, errors.Wrap(err, "cannot record discovery time"))
 		return rsp, nil
 	}
 
-	key, err := f.ServiceAccountSecret(oxr.Resource.GetLabels()["crossplane.io/claim-namespace"], oxr.Resource.GetLabels()["crossplane.io/claim-name"])
+	var (
+		algs      []string
+		jwks      []byte
+		key       crypto.PublicKey
+		secretRef ServiceAccountSecretRef
+	)
+	stepCtx, done := startStep(ctx, "service_account_secret", f.stepTimeout(input.Spec.Timeouts, "service_account_secret"))
+	if secretRef, err = f.ResolveServiceAccountSecret(&oxr.Resource.Unstructured, input.Spec.ServiceAccountSecret); err == nil {
+		key, err = f.ServiceAccountSecret(stepCtx, secretRef)
+	}
+	done(err)
+	keysMissing.Set(oxr.Resource.GetName(), err != nil)
 	if err != nil {
-		f.log.Debug("cannot get service account secret", "error", err)
+		reason := reasonSecretUnavailable
+		var keyErr *ServiceAccountKeyError
+		if errors.As(err, &keyErr) {
+			reason = keyErr.Reason
+		}
+		if isTimeout(stepCtx, err) {
+			reason = reasonTimedOut
+		}
+
+		f.log.Info("cannot get service account secret", "error", err, "reason", reason)
+		err = errors.Wrap(err, "cannot get service account signing key")
+		if input.Spec.FailOnMissingKeys && reason != reasonTimedOut {
+			response.Fatal(rsp, err)
+			return rsp, nil
+		}
+
+		if reason == reasonTimedOut {
+			warnTimeout(rsp, err)
+		} else {
+			response.Warning(rsp, err).WithReason(reason).TargetCompositeAndClaim()
+		}
+		setCondition(rsp, conditionKeysGenerated, false, reason, err.Error())
+
+		if err = f.RetainKeyHistory(input.Spec, oxr.Resource, composed); err != nil {
+			response.Fatal(rsp, errors.Wrap(err, "cannot retain key history"))
+			return rsp, nil
+		}
+
+		if input.Spec.KeyIDPatchToRef != "" {
+			f.carryForward(input.Spec.KeyIDPatchToRef, oxr, composed)
+		}
+
+		// Keep uploading the last published JWKS rather than removing it,
+		// and keep advertising the algorithms of the keys it holds
+		jwks = f.observedDocument(input.Spec.S3KeysPatchToRef, oxr.Resource)
+		algs = f.jwksAlgorithms(jwks)
 	} else {
-		if err = f.GenerateKeysFile(key, input.Spec.S3KeysPatchToRef, composed); err != nil {
-			response.Fatal(rsp, errors.Wrapf(err, "cannot generate keys file for domain %q", domain))
+		if algs, jwks, err = f.PublishKeys(key, input.Spec, oxr.Resource, composed); err != nil {
+			err = errors.Wrapf(err, "cannot generate keys file for domain %q", domain)
+			setCondition(rsp, conditionKeysGenerated, false, reasonGenerationFailed, err.Error())
+			response.Fatal(rsp, err)
 			return rsp, nil
 		}
+		setCondition(rsp, conditionKeysGenerated, true, reasonGenerated,
+			"Published signing key from secret "+secretRef.Namespace+"/"+secretRef.Name)
+	}
+
+	var discovery []byte
+	if discovery, err = f.GenerateDiscoveryFile(issuer, algs, input.Spec.S3DiscoveryPatchToRef, composed); err != nil {
+		err = errors.Wrapf(err, "cannot generate discovery file for issuer %q", issuer)
+		setCondition(rsp, conditionDiscoveryDocumentGenerated, false, reasonGenerationFailed, err.Error())
+		response.Fatal(rsp, err)
+		return rsp, nil
+	}
+	setCondition(rsp, conditionDiscoveryDocumentGenerated, true, reasonGenerated, "Generated discovery document for issuer "+issuer)
+
+	native := input.Spec.Rendering != nil && input.Spec.Rendering.Renderer == v1beta1.RendererNative
+
+	// The native renderer always uploads the documents itself
+	bucketObjects := input.Spec.BucketObjects
+	if native && (bucketObjects == nil || !bucketObjects.Enabled) {
+		bucketObjects = &v1beta1.BucketObjects{Enabled: true}
+		if input.Spec.BucketObjects != nil {
+			bucketObjects.CacheControl = input.Spec.BucketObjects.CacheControl
+		}
+	}
+
+	objectParams := BucketObjectParams{
+		Name:           oxr.Resource.GetName(),
+		BucketName:     S3BucketName,
+		Region:         region,
+		ProviderConfig: providerConfig,
+	}
+	if err = f.ComposeBucketObjects(bucketObjects, objectParams, discovery, jwks, composed); err != nil {
+		response.Fatal(rsp, errors.Wrap(err, "cannot compose bucket objects"))
+		return rsp, nil
+	}
+
+	if native {
+		var tags map[string]string
+		if tags, err = f.resourceTags(input.Spec.Rendering, oxr); err != nil {
+			response.Fatal(rsp, err)
+			return rsp, nil
+		}
+
+		params := RenderParams{
+			Name:                     oxr.Resource.GetName(),
+			Mode:                     mode,
+			Partition:                partition,
+			Region:                   region,
+			BucketName:               S3BucketName,
+			Domain:                   domain,
+			Issuer:                   issuer,
+			ProviderConfig:           providerConfig,
+			DNSProviderConfig:        dnsProviderConfig,
+			CloudFrontProviderConfig: cloudFrontProviderConfig,
+			IAMProviderConfig:        iamProviderConfig,
+			Tags:                     tags,
+			Thumbprint:               thumbprint,
+			HostedZoneID:             f.desiredString(input.Spec.Route53HostedZonePatchToRef, composed),
+			DistributionID:           f.desiredString(distributionIdRef, composed),
+			OpenIdProviderArn:        f.desiredString(openIdProviderArnRef, composed),
+		}
+		_, done := startStep(ctx, "render", 0)
+		err = f.RenderResources(params, composed)
+		done(err)
+		if err != nil {
+			response.Fatal(rsp, errors.Wrap(err, "cannot render managed resources"))
+			return rsp, nil
+		}
+	}
+
+	if dryRun != nil {
+		dryRun.Report(rsp, input.Spec, oxr, composed)
 	}
 
 	if err = composed.ToResponse(rsp); err != nil {
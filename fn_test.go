@@ -0,0 +1,33 @@
+package main
+
+import (
+	"github.com/crossplane/function-sdk-go/logging"
+	"github.com/crossplane/function-sdk-go/resource"
+	"github.com/crossplane/function-sdk-go/resource/composite"
+	xfncomposite "github.com/giantswarm/xfnlib/pkg/composite"
+)
+
+// newTestFunction returns a function without caches that does not log
+func newTestFunction() *Function {
+	return &Function{log: logging.NewNopLogger()}
+}
+
+// newTestComposition returns an empty composition for the given observed XR
+func newTestComposition(oxr map[string]any) (*resource.Composite, *xfncomposite.Composition) {
+	observed := &resource.Composite{Resource: composite.New()}
+	if oxr != nil {
+		observed.Resource.Object = oxr
+	}
+	observed.Resource.SetAPIVersion("test.giantswarm.io/v1alpha1")
+	observed.Resource.SetKind("XIRSA")
+
+	desired := &resource.Composite{Resource: composite.New()}
+	desired.Resource.SetAPIVersion(observed.Resource.GetAPIVersion())
+	desired.Resource.SetKind(observed.Resource.GetKind())
+
+	return observed, &xfncomposite.Composition{
+		DesiredComposite: desired,
+		ObservedComposed: map[resource.Name]resource.ObservedComposed{},
+		DesiredComposed:  map[resource.Name]*resource.DesiredComposed{},
+	}
+}
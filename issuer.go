@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+	"github.com/giantswarm/xfnlib/pkg/composite"
+
+	"github.com/giantswarm/crossplane-fn-irsa/pkg/input/v1beta1"
+)
+
+// ResolveIssuerMode returns the issuer mode to use in the given partition.
+// Without an explicit mode CloudFront is used where available and the
+// path-style S3 endpoint elsewhere.
+func ResolveIssuerMode(mode v1beta1.IssuerMode, partition Partition) (v1beta1.IssuerMode, error) {
+	switch mode {
+	case "":
+		if partition.CloudFront {
+			return v1beta1.IssuerModeCloudFront, nil
+		}
+		return v1beta1.IssuerModeS3PathStyle, nil
+	case v1beta1.IssuerModeCloudFront:
+		if !partition.CloudFront {
+			return mode, errors.Errorf("issuer mode %s is not available in partition %s", mode, partition.ID)
+		}
+		return mode, nil
+	case v1beta1.IssuerModeS3PathStyle, v1beta1.IssuerModeS3VirtualHost, v1beta1.IssuerModeCustom:
+		return mode, nil
+	}
+
+	return mode, errors.Errorf("unknown issuer mode %q", mode)
+}
+
+// IssuerURL returns the OIDC issuer of the cluster for the given mode.
+func IssuerURL(mode v1beta1.IssuerMode, domain, bucketName, region, customURL string) (string, error) {
+	partition := PartitionForRegion(region)
+
+	switch mode {
+	case v1beta1.IssuerModeCloudFront:
+		return fmt.Sprintf("https://%s", domain), nil
+	case v1beta1.IssuerModeS3PathStyle:
+		return fmt.Sprintf("https://%s/%s", partition.S3Endpoint(region), bucketName), nil
+	case v1beta1.IssuerModeS3VirtualHost:
+		return fmt.Sprintf("https://%s.%s", bucketName, partition.S3Endpoint(region)), nil
+	case v1beta1.IssuerModeCustom:
+		if customURL == "" {
+			return "", errors.New("issuer mode Custom requires a custom issuer URL")
+		}
+		return normalizeIssuerURL(customURL), nil
+	}
+
+	return "", errors.Errorf("unknown issuer mode %q", mode)
+}
+
+// JWKSURI returns the location of the JWKS published for the issuer.
+func JWKSURI(issuer string) string {
+	return issuer + "/keys.json"
+}
+
+// PublishIssuer patches the issuer URL, JWKS URI and resolved issuer mode to
+// the desired XR for the references set in the input, so consumers do not have
+// to derive them.
+func (f *Function) PublishIssuer(issuer string, mode v1beta1.IssuerMode, spec *v1beta1.Spec, composed *composite.Composition) (err error) {
+	if spec.IssuerURLPatchToRef != "" {
+		if err = f.patchFieldValueToObject(spec.IssuerURLPatchToRef, issuer, composed.DesiredComposite.Resource); err != nil {
+			return errors.Wrapf(err, "cannot patch issuer URL to %q", spec.IssuerURLPatchToRef)
+		}
+	}
+
+	if spec.JWKSURIPatchToRef != "" {
+		if err = f.patchFieldValueToObject(spec.JWKSURIPatchToRef, JWKSURI(issuer), composed.DesiredComposite.Resource); err != nil {
+			return errors.Wrapf(err, "cannot patch JWKS URI to %q", spec.JWKSURIPatchToRef)
+		}
+	}
+
+	if spec.IssuerModePatchToRef != "" {
+		if err = f.patchFieldValueToObject(spec.IssuerModePatchToRef, string(mode), composed.DesiredComposite.Resource); err != nil {
+			return errors.Wrapf(err, "cannot patch issuer mode to %q", spec.IssuerModePatchToRef)
+		}
+	}
+
+	return nil
+}
+
+// normalizeIssuerURL ensures the issuer uses https and has no trailing slash,
+// as required for the issuer to match the iss claim of tokens.
+func normalizeIssuerURL(issuer string) string {
+	return "https://" + normalizeIssuer(issuer)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/crossplane/crossplane-runtime/pkg/fieldpath"
+
+	"github.com/giantswarm/crossplane-fn-irsa/pkg/input/v1beta1"
+)
+
+func TestResolveIssuerMode(t *testing.T) {
+	cases := map[string]struct {
+		mode    v1beta1.IssuerMode
+		region  string
+		want    v1beta1.IssuerMode
+		wantErr bool
+	}{
+		"DefaultCommercial":    {region: "eu-west-1", want: v1beta1.IssuerModeCloudFront},
+		"DefaultChina":         {region: "cn-north-1", want: v1beta1.IssuerModeS3PathStyle},
+		"DefaultGovCloud":      {region: "us-gov-west-1", want: v1beta1.IssuerModeS3PathStyle},
+		"CloudFrontCommercial": {mode: v1beta1.IssuerModeCloudFront, region: "eu-west-1", want: v1beta1.IssuerModeCloudFront},
+		"CloudFrontChina":      {mode: v1beta1.IssuerModeCloudFront, region: "cn-north-1", wantErr: true},
+		"CloudFrontGovCloud":   {mode: v1beta1.IssuerModeCloudFront, region: "us-gov-west-1", wantErr: true},
+		"VirtualHostGovCloud":  {mode: v1beta1.IssuerModeS3VirtualHost, region: "us-gov-west-1", want: v1beta1.IssuerModeS3VirtualHost},
+		"Unknown":              {mode: "Website", region: "eu-west-1", wantErr: true},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := ResolveIssuerMode(tc.mode, PartitionForRegion(tc.region))
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("ResolveIssuerMode() error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if !tc.wantErr && got != tc.want {
+				t.Errorf("ResolveIssuerMode() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestIssuerURL(t *testing.T) {
+	const (
+		domain = "test.example.com"
+		bucket = "test-irsa"
+	)
+
+	cases := map[string]struct {
+		mode      v1beta1.IssuerMode
+		region    string
+		customURL string
+		want      string
+		wantErr   bool
+	}{
+		"CloudFront":            {mode: v1beta1.IssuerModeCloudFront, region: "eu-west-1", want: "https://test.example.com"},
+		"S3PathStyle":           {mode: v1beta1.IssuerModeS3PathStyle, region: "eu-west-1", want: "https://s3.eu-west-1.amazonaws.com/test-irsa"},
+		"S3PathStyleChina":      {mode: v1beta1.IssuerModeS3PathStyle, region: "cn-north-1", want: "https://s3.cn-north-1.amazonaws.com.cn/test-irsa"},
+		"S3PathStyleGovCloud":   {mode: v1beta1.IssuerModeS3PathStyle, region: "us-gov-west-1", want: "https://s3.us-gov-west-1.amazonaws.com/test-irsa"},
+		"S3VirtualHost":         {mode: v1beta1.IssuerModeS3VirtualHost, region: "eu-west-1", want: "https://test-irsa.s3.eu-west-1.amazonaws.com"},
+		"S3VirtualHostChina":    {mode: v1beta1.IssuerModeS3VirtualHost, region: "cn-northwest-1", want: "https://test-irsa.s3.cn-northwest-1.amazonaws.com.cn"},
+		"S3VirtualHostGovCloud": {mode: v1beta1.IssuerModeS3VirtualHost, region: "us-gov-east-1", want: "https://test-irsa.s3.us-gov-east-1.amazonaws.com"},
+		"Custom":                {mode: v1beta1.IssuerModeCustom, region: "eu-west-1", customURL: "https://oidc.example.com/test/", want: "https://oidc.example.com/test"},
+		"CustomWithoutScheme":   {mode: v1beta1.IssuerModeCustom, region: "cn-north-1", customURL: "oidc.example.cn", want: "https://oidc.example.cn"},
+		"CustomMissing":         {mode: v1beta1.IssuerModeCustom, region: "eu-west-1", wantErr: true},
+		"Unknown":               {mode: "Website", region: "eu-west-1", wantErr: true},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := IssuerURL(tc.mode, domain, bucket, tc.region, tc.customURL)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("IssuerURL() error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if got != tc.want {
+				t.Errorf("IssuerURL() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestPublishIssuer(t *testing.T) {
+	const issuer = "https://s3.cn-north-1.amazonaws.com.cn/test-irsa"
+
+	_, c := newTestComposition(map[string]any{})
+	spec := &v1beta1.Spec{
+		IssuerURLPatchToRef:  "status.issuerURL",
+		JWKSURIPatchToRef:    "status.jwksURI",
+		IssuerModePatchToRef: "status.issuerMode",
+	}
+
+	if err := newTestFunction().PublishIssuer(issuer, v1beta1.IssuerModeS3PathStyle, spec, c); err != nil {
+		t.Fatalf("PublishIssuer() error = %v", err)
+	}
+
+	paved := fieldpath.Pave(c.DesiredComposite.Resource.Object)
+	for ref, want := range map[string]string{
+		"status.issuerURL":  issuer,
+		"status.jwksURI":    issuer + "/keys.json",
+		"status.issuerMode": "S3PathStyle",
+	} {
+		if got, _ := paved.GetString(ref); got != want {
+			t.Errorf("%s = %q, want %q", ref, got, want)
+		}
+	}
+}
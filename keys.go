@@ -0,0 +1,332 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"time"
+
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+	"github.com/crossplane/crossplane-runtime/pkg/fieldpath"
+	"github.com/giantswarm/xfnlib/pkg/composite"
+	"gopkg.in/square/go-jose.v2"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/giantswarm/crossplane-fn-irsa/pkg/input/v1beta1"
+)
+
+// defaultKeyRotationOverlap is how long a rotated-out signing key remains in
+// the published JWKS when the input does not define an overlap window.
+const defaultKeyRotationOverlap = 24 * time.Hour
+
+// now is overridable to allow key retirement to be tested deterministically.
+var now = time.Now
+
+// KeyHistoryEntry is a signing key that has been published in the JWKS and is
+// retained on the XR status so that it survives a rotation of the key in the
+// service account secret.
+type KeyHistoryEntry struct {
+	// KeyID is the kid under which the key is published
+	KeyID string `json:"kid"`
+
+	// PublicKey is the PEM encoded PKIX public key
+	PublicKey string `json:"publicKey"`
+
+	// RetiredAt is set once the key is no longer the current signing key
+	RetiredAt string `json:"retiredAt,omitempty"`
+}
+
+// serviceAccountKeyNames are the secret data keys searched, in order, for the
+// service account signing key. Any of them may hold either the private key or
+// only the public part of it.
+var serviceAccountKeyNames = []string{"tls.key", "tls.crt", "sa.pub"}
+
+// PublishKeys generates the JWKS for the current signing key and returns the
+// signing algorithms of all published keys together with the JWKS.
+//
+// When the input defines a key history reference, previous keys recorded on
+// the observed XR are published alongside the current key until their overlap
+// window has elapsed, and the updated history is patched to the desired XR.
+// The key ID of the current key is patched to the key ID reference if set.
+func (f *Function) PublishKeys(current crypto.PublicKey, spec *v1beta1.Spec, observed runtime.Object, composed *composite.Composition) (algs []string, jwks []byte, err error) {
+	var (
+		keys    = []crypto.PublicKey{current}
+		history []KeyHistoryEntry
+	)
+
+	if spec.S3KeysHistoryPatchToRef != "" {
+		if history, err = f.getKeyHistory(observed, spec.S3KeysHistoryPatchToRef); err != nil {
+			return
+		}
+
+		overlap := defaultKeyRotationOverlap
+		if spec.KeyRotationOverlap != nil {
+			overlap = spec.KeyRotationOverlap.Duration
+		}
+
+		if keys, history, err = f.RotateKeys(current, history, overlap); err != nil {
+			return
+		}
+
+		if err = f.patchFieldValueToObject(spec.S3KeysHistoryPatchToRef, history, composed.DesiredComposite.Resource); err != nil {
+			return
+		}
+	}
+
+	if spec.KeyIDPatchToRef != "" {
+		var kid string
+		if kid, err = digestOfKey(current); err != nil {
+			return
+		}
+
+		if err = f.patchFieldValueToObject(spec.KeyIDPatchToRef, kid, composed.DesiredComposite.Resource); err != nil {
+			return
+		}
+	}
+
+	if algs, err = signingAlgorithms(keys); err != nil {
+		return
+	}
+
+	jwks, err = f.GenerateKeysFile(keys, spec.S3KeysPatchToRef, composed)
+	return
+}
+
+// RetainKeyHistory carries the key history from the observed XR over to the
+// desired XR unchanged. This is used when the current signing key cannot be
+// read so that previously published keys are not forgotten.
+func (f *Function) RetainKeyHistory(spec *v1beta1.Spec, observed runtime.Object, composed *composite.Composition) (err error) {
+	var history []KeyHistoryEntry
+	if spec.S3KeysHistoryPatchToRef == "" {
+		return
+	}
+
+	if history, err = f.getKeyHistory(observed, spec.S3KeysHistoryPatchToRef); err != nil || len(history) == 0 {
+		return
+	}
+
+	return f.patchFieldValueToObject(spec.S3KeysHistoryPatchToRef, history, composed.DesiredComposite.Resource)
+}
+
+// RotateKeys merges the current signing key with the retained key history.
+//
+// Keys that are no longer current are marked as retired and continue to be
+// published until the overlap window has elapsed, after which they are dropped
+// from both the returned key set and the history. The current key is always
+// the first entry.
+func (f *Function) RotateKeys(current crypto.PublicKey, history []KeyHistoryEntry, overlap time.Duration) (keys []crypto.PublicKey, retained []KeyHistoryEntry, err error) {
+	var (
+		kid string
+		enc string
+		ts  = now().UTC()
+	)
+
+	if kid, err = digestOfKey(current); err != nil {
+		return
+	}
+
+	if enc, err = encodePublicKey(current); err != nil {
+		return
+	}
+
+	keys = append(keys, current)
+	retained = append(retained, KeyHistoryEntry{
+		KeyID:     kid,
+		PublicKey: enc,
+	})
+
+	for _, entry := range history {
+		if entry.KeyID == kid {
+			continue
+		}
+
+		retiredAt := ts
+		if entry.RetiredAt != "" {
+			var perr error
+			if retiredAt, perr = time.Parse(time.RFC3339, entry.RetiredAt); perr != nil {
+				f.log.Info("Invalid retirement time on key, retiring now", "kid", entry.KeyID, "error", perr)
+				retiredAt = ts
+			}
+		}
+
+		if ts.Sub(retiredAt) >= overlap {
+			f.log.Info("Dropping retired signing key", "kid", entry.KeyID, "retiredAt", entry.RetiredAt)
+			continue
+		}
+
+		var key crypto.PublicKey
+		if key, err = decodePublicKey(entry.PublicKey); err != nil {
+			err = errors.Wrapf(err, "cannot decode retained key %q", entry.KeyID)
+			return
+		}
+
+		f.log.Debug("Retaining previous signing key", "kid", entry.KeyID, "retiredAt", retiredAt)
+		keys = append(keys, key)
+		retained = append(retained, KeyHistoryEntry{
+			KeyID:     entry.KeyID,
+			PublicKey: entry.PublicKey,
+			RetiredAt: retiredAt.Format(time.RFC3339),
+		})
+	}
+
+	return
+}
+
+func (f *Function) getKeyHistory(observed runtime.Object, ref string) (history []KeyHistoryEntry, err error) {
+	var paved *fieldpath.Paved
+	if paved, err = fieldpath.PaveObject(observed); err != nil {
+		return
+	}
+
+	if err = paved.GetValueInto(ref, &history); err != nil {
+		if fieldpath.IsNotFound(err) {
+			err = nil
+			return
+		}
+		err = errors.Wrapf(err, "cannot read key history from %q", ref)
+	}
+	return
+}
+
+// parseSigningKey decodes a PEM encoded service account key and returns its
+// public part. PKCS#1 and PKCS#8 private keys, SEC 1 EC private keys, PKIX and
+// PKCS#1 public keys and X.509 certificates are supported.
+func parseSigningKey(data []byte) (key crypto.PublicKey, err error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		err = errors.New("no PEM data found")
+		return
+	}
+
+	var parsed any
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		parsed, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "CERTIFICATE":
+		var cert *x509.Certificate
+		if cert, err = x509.ParseCertificate(block.Bytes); err == nil {
+			parsed = cert.PublicKey
+		}
+	default:
+		err = errors.Errorf("unsupported PEM block type %q", block.Type)
+	}
+
+	if err != nil {
+		err = errors.Wrapf(err, "cannot parse %q", block.Type)
+		return
+	}
+
+	if signer, ok := parsed.(crypto.Signer); ok {
+		parsed = signer.Public()
+	}
+
+	if _, err = signingAlgorithm(parsed); err != nil {
+		return
+	}
+
+	key = parsed
+	return
+}
+
+// signingAlgorithm returns the JWS algorithm tokens signed by the given key
+// are issued with.
+func signingAlgorithm(key crypto.PublicKey) (alg jose.SignatureAlgorithm, err error) {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		alg = jose.RS256
+	case *ecdsa.PublicKey:
+		switch k.Curve {
+		case elliptic.P256():
+			alg = jose.ES256
+		case elliptic.P384():
+			alg = jose.ES384
+		case elliptic.P521():
+			alg = jose.ES512
+		default:
+			err = errors.Errorf("unsupported elliptic curve %q", k.Curve.Params().Name)
+		}
+	default:
+		err = errors.Errorf("unsupported signing key type %T", key)
+	}
+	return
+}
+
+// signingAlgorithms returns the distinct algorithms of the given keys in the
+// order they first appear.
+func signingAlgorithms(keys []crypto.PublicKey) (algs []string, err error) {
+	seen := make(map[jose.SignatureAlgorithm]bool)
+	for _, key := range keys {
+		var alg jose.SignatureAlgorithm
+		if alg, err = signingAlgorithm(key); err != nil {
+			return
+		}
+
+		if !seen[alg] {
+			seen[alg] = true
+			algs = append(algs, string(alg))
+		}
+	}
+	return
+}
+
+// jwksAlgorithms returns the distinct algorithms of the keys in a published
+// JWKS in the order they first appear, or nil if it cannot be decoded.
+func (f *Function) jwksAlgorithms(jwks []byte) (algs []string) {
+	if len(jwks) == 0 {
+		return nil
+	}
+
+	var set jose.JSONWebKeySet
+	if err := json.Unmarshal(jwks, &set); err != nil {
+		f.log.Debug("Cannot decode published JWKS", "error", err)
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	for _, key := range set.Keys {
+		alg := key.Algorithm
+		if alg == "" {
+			a, err := signingAlgorithm(key.Key)
+			if err != nil {
+				continue
+			}
+			alg = string(a)
+		}
+
+		if !seen[alg] {
+			seen[alg] = true
+			algs = append(algs, alg)
+		}
+	}
+	return
+}
+
+func encodePublicKey(key crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to serialize public key to DER format")
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})), nil
+}
+
+func decodePublicKey(data string) (crypto.PublicKey, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"gopkg.in/square/go-jose.v2"
+)
+
+// withNow fixes the time seen by the function for the test
+func withNow(t *testing.T, ts time.Time) {
+	t.Helper()
+	orig := now
+	now = func() time.Time { return ts }
+	t.Cleanup(func() { now = orig })
+}
+
+func testKey(t *testing.T, curve elliptic.Curve) crypto.PublicKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key.Public()
+}
+
+func keyIDs(t *testing.T, keys []crypto.PublicKey) []string {
+	t.Helper()
+	ids := make([]string, len(keys))
+	for i, key := range keys {
+		kid, err := digestOfKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[i] = kid
+	}
+	return ids
+}
+
+func TestRotateKeys(t *testing.T) {
+	var (
+		f       = newTestFunction()
+		overlap = 24 * time.Hour
+		start   = time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+		first  = testKey(t, elliptic.P256())
+		second = testKey(t, elliptic.P384())
+	)
+
+	firstID, secondID := keyIDs(t, []crypto.PublicKey{first})[0], keyIDs(t, []crypto.PublicKey{second})[0]
+
+	// The first run seeds the history with the current key
+	withNow(t, start)
+	keys, history, err := f.RotateKeys(first, nil, overlap)
+	if err != nil {
+		t.Fatalf("RotateKeys() error = %v", err)
+	}
+	if got := keyIDs(t, keys); len(got) != 1 || got[0] != firstID {
+		t.Fatalf("RotateKeys() keys = %v, want [%s]", got, firstID)
+	}
+	if len(history) != 1 || history[0].KeyID != firstID || history[0].RetiredAt != "" {
+		t.Fatalf("RotateKeys() history = %+v, want only the current key", history)
+	}
+
+	// An unchanged key leaves the history unchanged
+	withNow(t, start.Add(time.Hour))
+	if _, unchanged, err := f.RotateKeys(first, history, overlap); err != nil || len(unchanged) != 1 || unchanged[0] != history[0] {
+		t.Fatalf("RotateKeys() history = %+v, error = %v, want %+v", unchanged, err, history)
+	}
+
+	// Rotating retires the previous key and lists the new one first
+	rotatedAt := start.Add(2 * time.Hour)
+	withNow(t, rotatedAt)
+	keys, history, err = f.RotateKeys(second, history, overlap)
+	if err != nil {
+		t.Fatalf("RotateKeys() error = %v", err)
+	}
+	if got := keyIDs(t, keys); len(got) != 2 || got[0] != secondID || got[1] != firstID {
+		t.Fatalf("RotateKeys() keys = %v, want [%s %s]", got, secondID, firstID)
+	}
+	if len(history) != 2 || history[0].KeyID != secondID || history[0].RetiredAt != "" {
+		t.Fatalf("RotateKeys() history = %+v, want the current key first and not retired", history)
+	}
+	if history[1].KeyID != firstID || history[1].RetiredAt != rotatedAt.Format(time.RFC3339) {
+		t.Fatalf("RotateKeys() history = %+v, want %s retired at %s", history, firstID, rotatedAt.Format(time.RFC3339))
+	}
+
+	// Within the overlap the retirement time is kept
+	withNow(t, rotatedAt.Add(overlap-time.Second))
+	keys, kept, err := f.RotateKeys(second, history, overlap)
+	if err != nil {
+		t.Fatalf("RotateKeys() error = %v", err)
+	}
+	if len(keys) != 2 || len(kept) != 2 || kept[1].RetiredAt != history[1].RetiredAt {
+		t.Fatalf("RotateKeys() history = %+v, want %s kept until the overlap elapsed", kept, firstID)
+	}
+
+	// Once the overlap elapsed the retired key is dropped
+	withNow(t, rotatedAt.Add(overlap))
+	keys, history, err = f.RotateKeys(second, kept, overlap)
+	if err != nil {
+		t.Fatalf("RotateKeys() error = %v", err)
+	}
+	if got := keyIDs(t, keys); len(got) != 1 || got[0] != secondID {
+		t.Fatalf("RotateKeys() keys = %v, want [%s]", got, secondID)
+	}
+	if len(history) != 1 || history[0].KeyID != secondID {
+		t.Fatalf("RotateKeys() history = %+v, want only the current key", history)
+	}
+}
+
+func TestRotateKeysInvalidRetiredAt(t *testing.T) {
+	var (
+		f       = newTestFunction()
+		overlap = time.Hour
+		ts      = time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+		current  = testKey(t, elliptic.P256())
+		previous = testKey(t, elliptic.P256())
+	)
+	withNow(t, ts)
+
+	enc, err := encodePublicKey(previous)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previousID := keyIDs(t, []crypto.PublicKey{previous})[0]
+
+	for name, retiredAt := range map[string]string{
+		"Unparsable": "yesterday",
+		"Unset":      "",
+	} {
+		t.Run(name, func(t *testing.T) {
+			keys, history, err := f.RotateKeys(current, []KeyHistoryEntry{{KeyID: previousID, PublicKey: enc, RetiredAt: retiredAt}}, overlap)
+			if err != nil {
+				t.Fatalf("RotateKeys() error = %v", err)
+			}
+			if len(keys) != 2 || len(history) != 2 {
+				t.Fatalf("RotateKeys() kept %d keys, want the previous key retained", len(keys))
+			}
+			if history[1].RetiredAt != ts.Format(time.RFC3339) {
+				t.Errorf("RotateKeys() retiredAt = %q, want %q", history[1].RetiredAt, ts.Format(time.RFC3339))
+			}
+		})
+	}
+}
+
+func TestRotateKeysCurrentFirst(t *testing.T) {
+	var (
+		f       = newTestFunction()
+		overlap = 24 * time.Hour
+		ts      = time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	)
+	withNow(t, ts)
+
+	// The current key may appear anywhere in the recorded history, for
+	// example after rotating back to a previous key
+	current := testKey(t, elliptic.P256())
+	others := []crypto.PublicKey{testKey(t, elliptic.P256()), testKey(t, elliptic.P384())}
+
+	var history []KeyHistoryEntry
+	for _, key := range append(others, current) {
+		enc, err := encodePublicKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		history = append(history, KeyHistoryEntry{
+			KeyID:     keyIDs(t, []crypto.PublicKey{key})[0],
+			PublicKey: enc,
+			RetiredAt: ts.Add(-time.Hour).Format(time.RFC3339),
+		})
+	}
+
+	keys, retained, err := f.RotateKeys(current, history, overlap)
+	if err != nil {
+		t.Fatalf("RotateKeys() error = %v", err)
+	}
+
+	currentID := keyIDs(t, []crypto.PublicKey{current})[0]
+	if got := keyIDs(t, keys); len(got) != 3 || got[0] != currentID {
+		t.Fatalf("RotateKeys() keys = %v, want %s first", got, currentID)
+	}
+	if retained[0].KeyID != currentID || retained[0].RetiredAt != "" {
+		t.Errorf("RotateKeys() history = %+v, want %s first and not retired", retained, currentID)
+	}
+
+	algs, err := signingAlgorithms(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(algs) != 2 || algs[0] != "ES256" || algs[1] != "ES384" {
+		t.Errorf("signingAlgorithms() = %v, want [ES256 ES384]", algs)
+	}
+}
+
+func TestJWKSAlgorithms(t *testing.T) {
+	f := newTestFunction()
+
+	published := func(keys ...crypto.PublicKey) []byte {
+		_, c := newTestComposition(nil)
+		jwks, err := f.GenerateKeysFile(keys, "status.jwks", c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return jwks
+	}
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaJWK, err := json.Marshal(jose.JSONWebKey{Key: rsaKey.Public(), KeyID: "rsa", Use: "sig"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]struct {
+		jwks []byte
+		want []string
+	}{
+		"EC": {
+			jwks: published(testKey(t, elliptic.P384()), testKey(t, elliptic.P256()), testKey(t, elliptic.P384())),
+			want: []string{"ES384", "ES256"},
+		},
+		"WithoutAlg": {
+			jwks: []byte(`{"keys":[` + string(rsaJWK) + `]}`),
+			want: []string{"RS256"},
+		},
+		"Empty":   {},
+		"Invalid": {jwks: []byte("not json")},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.want, f.jwksAlgorithms(tc.jwks)); diff != "" {
+				t.Errorf("jwksAlgorithms() -want, +got:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParseSigningKey(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p224Key, err := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encode := func(blockType string) func([]byte, error) []byte {
+		return func(der []byte, err error) []byte {
+			t.Helper()
+			if err != nil {
+				t.Fatal(err)
+			}
+			return pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+		}
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "service-accounts"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	cases := map[string]struct {
+		data    []byte
+		want    crypto.PublicKey
+		wantErr bool
+	}{
+		"RSAPKCS1PrivateKey": {
+			data: encode("RSA PRIVATE KEY")(x509.MarshalPKCS1PrivateKey(rsaKey), nil),
+			want: rsaKey.Public(),
+		},
+		"RSAPKCS8PrivateKey": {
+			data: encode("PRIVATE KEY")(x509.MarshalPKCS8PrivateKey(rsaKey)),
+			want: rsaKey.Public(),
+		},
+		"ECPKCS8PrivateKey": {
+			data: encode("PRIVATE KEY")(x509.MarshalPKCS8PrivateKey(ecKey)),
+			want: ecKey.Public(),
+		},
+		"ECSEC1PrivateKey": {
+			data: encode("EC PRIVATE KEY")(x509.MarshalECPrivateKey(ecKey)),
+			want: ecKey.Public(),
+		},
+		"PKIXPublicKey": {
+			data: encode("PUBLIC KEY")(x509.MarshalPKIXPublicKey(ecKey.Public())),
+			want: ecKey.Public(),
+		},
+		"PKCS1PublicKey": {
+			data: encode("RSA PUBLIC KEY")(x509.MarshalPKCS1PublicKey(&rsaKey.PublicKey), nil),
+			want: rsaKey.Public(),
+		},
+		"Certificate": {
+			data: encode("CERTIFICATE")(x509.CreateCertificate(rand.Reader, template, template, rsaKey.Public(), rsaKey)),
+			want: rsaKey.Public(),
+		},
+		"UnsupportedCurve": {
+			data:    encode("EC PRIVATE KEY")(x509.MarshalECPrivateKey(p224Key)),
+			wantErr: true,
+		},
+		"UnsupportedKeyType": {
+			data:    encode("PRIVATE KEY")(x509.MarshalPKCS8PrivateKey(edKey)),
+			wantErr: true,
+		},
+		"UnsupportedBlockType": {
+			data:    encode("OPENSSH PRIVATE KEY")([]byte("key"), nil),
+			wantErr: true,
+		},
+		"MismatchedBlockType": {
+			data:    encode("RSA PRIVATE KEY")(x509.MarshalECPrivateKey(ecKey)),
+			wantErr: true,
+		},
+		"NoPEM": {
+			data:    []byte("not a key"),
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := parseSigningKey(tc.data)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("parseSigningKey() error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if tc.wantErr {
+				return
+			}
+			if k, ok := got.(interface{ Equal(crypto.PublicKey) bool }); !ok || !k.Equal(tc.want) {
+				t.Errorf("parseSigningKey() = %T, want the public part of the key", got)
+			}
+		})
+	}
+}
@@ -2,6 +2,9 @@
 package main
 
 import (
+	"context"
+	"time"
+
 	"github.com/alecthomas/kong"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
@@ -18,6 +21,27 @@ type CLI struct {
 	Address     string `help:"Address at which to listen for gRPC connections." default:":9443"`
 	TLSCertsDir string `help:"Directory containing server certs (tls.key, tls.crt) and the CA used to verify client certificates (ca.crt)" env:"TLS_SERVER_CERTS_DIR"`
 	Insecure    bool   `help:"Run without mTLS credentials. If you supply this flag --tls-server-certs-dir will be ignored."`
+
+	AWSConfigTTL time.Duration `help:"How long a resolved AWS config is reused before the ProviderConfig is read again." default:"15m"`
+
+	DiscoveryCacheTTL         time.Duration `help:"How long discovered hosted zones, distributions and OpenID Connect providers are cached. Set to 0 to disable the cache." default:"5m"`
+	DiscoveryCacheNegativeTTL time.Duration `help:"How long a discovery lookup that found nothing or failed is cached. Set to 0 to not cache negative results." default:"1m"`
+
+	AWSMaxAttempts int           `help:"Maximum number of attempts of an AWS API call, including the first." default:"5"`
+	AWSMaxBackoff  time.Duration `help:"Maximum delay between two attempts of an AWS API call." default:"20s"`
+	AWSRetryMode   string        `help:"Retry mode of the AWS clients. Adaptive also slows down requests on the client side while a service is throttling." enum:"standard,adaptive" default:"standard"`
+	AWSRateLimit   float64       `help:"Maximum AWS API requests per second per account and service. Set to 0 to disable the limit." default:"5"`
+	AWSRateBurst   int           `help:"Number of AWS API requests per account and service allowed above the rate limit in a burst." default:"5"`
+
+	DiscoveryConcurrency int `help:"How many discovery steps of a RunFunction call run at the same time. Set to 1 to run them one after another." default:"3"`
+
+	StepTimeout time.Duration `help:"How long each discovery step may take before it is abandoned and previously recorded values are reused. Set to 0 to only bound steps by the request deadline." default:"20s"`
+
+	MetricsAddress string `help:"Address at which to serve Prometheus metrics on /metrics, e.g. :8080. Metrics are not served if empty." default:""`
+
+	OTLPEndpoint     string  `help:"OTLP gRPC endpoint to export traces to, e.g. localhost:4317 or http://localhost:4317. Tracing is disabled if empty." default:""`
+	OTLPInsecure     bool    `help:"Export traces without TLS."`
+	TraceSampleRatio float64 `help:"Fraction of RunFunction calls to trace, between 0 and 1." default:"1"`
 }
 
 // Run this Function.
@@ -26,7 +50,45 @@ func (c *CLI) Run() error {
 	log := logging.NewLogrLogger(zl.WithName(composedName))
 	ctrl.SetLogger(zl)
 
-	return function.Serve(&Function{log: log},
+	awsRetryOptions = RetryOptions{
+		MaxAttempts: c.AWSMaxAttempts,
+		MaxBackoff:  c.AWSMaxBackoff,
+		Adaptive:    c.AWSRetryMode == "adaptive",
+	}
+	awsRateLimitOptions = RateLimitOptions{
+		Rate:  c.AWSRateLimit,
+		Burst: c.AWSRateBurst,
+	}
+
+	if c.MetricsAddress != "" {
+		go func() {
+			log.Info("Serving metrics", "address", c.MetricsAddress)
+			if err := serveMetrics(c.MetricsAddress); err != nil {
+				log.Info("Metrics server stopped", "error", err)
+			}
+		}()
+	}
+
+	if c.OTLPEndpoint != "" {
+		shutdown, err := setupTracing(context.Background(), TracingOptions{
+			Endpoint:    c.OTLPEndpoint,
+			Insecure:    c.OTLPInsecure,
+			SampleRatio: c.TraceSampleRatio,
+		})
+		if err != nil {
+			return err
+		}
+		defer func() { _ = shutdown(context.Background()) }()
+		log.Info("Exporting traces", "endpoint", c.OTLPEndpoint)
+	}
+
+	return function.Serve(&Function{
+		log:         log,
+		clients:     newClientCache(c.AWSConfigTTL),
+		discovery:   newDiscoveryCache(c.DiscoveryCacheTTL, c.DiscoveryCacheNegativeTTL),
+		timeout:     c.StepTimeout,
+		concurrency: c.DiscoveryConcurrency,
+	},
 		function.Listen(c.Network, c.Address),
 		function.MTLSCertificates(c.TLSCertsDir),
 		function.Insecure(c.Insecure))
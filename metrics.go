@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/smithy-go/middleware"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const metricsNamespace = "crossplane_fn_irsa"
+
+// keysMissingStaleness is how long an XR is counted as missing keys without
+// being reconciled again, so that deleted XRs drop out of the gauge.
+const keysMissingStaleness = time.Hour
+
+// metricsRegistry holds all metrics exported by this function.
+var metricsRegistry = prometheus.NewRegistry()
+
+var (
+	discoveryCacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "discovery_cache",
+		Name:      "requests_total",
+		Help:      "Number of discovery cache lookups by service and result (hit, negative_hit, error_hit, miss).",
+	}, []string{"service", "result"})
+
+	runDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "run_duration_seconds",
+		Help:      "Duration of RunFunction calls by result (success, warning, fatal).",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"result"})
+
+	stepDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "step_duration_seconds",
+		Help:      "Duration of the individual steps of RunFunction.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"step"})
+
+	stepOutcomes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "step_outcomes_total",
+		Help:      "Outcomes of the individual steps by condition type, status and reason.",
+	}, []string{"condition", "status", "reason"})
+
+	awsRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "aws",
+		Name:      "requests_total",
+		Help:      "Number of AWS API calls by service, operation and result (success, error), including all retries.",
+	}, []string{"service", "operation", "result"})
+
+	awsRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "aws",
+		Name:      "request_duration_seconds",
+		Help:      "Duration of AWS API calls by service and operation, including all retries.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"service", "operation"})
+
+	awsAttemptErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "aws",
+		Name:      "attempt_errors_total",
+		Help:      "Number of failed AWS API call attempts by service, operation and reason (throttle, error).",
+	}, []string{"service", "operation", "reason"})
+
+	keysMissing = &xrTracker{seen: make(map[string]time.Time)}
+)
+
+func init() {
+	metricsRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		discoveryCacheRequests,
+		runDuration,
+		stepDuration,
+		stepOutcomes,
+		awsRequests,
+		awsRequestDuration,
+		awsAttemptErrors,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "xrs_missing_keys",
+			Help:      "Number of XRs whose service account signing key could not be read on their last reconcile.",
+		}, keysMissing.Count),
+	)
+}
+
+// serveMetrics serves the metrics registry on the given address until the
+// server fails.
+func serveMetrics(address string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{}))
+
+	server := &http.Server{
+		Addr:              address,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return server.ListenAndServe()
+}
+
+// observeRun records the duration and result of a RunFunction call
+func observeRun(start time.Time, rsp *fnv1.RunFunctionResponse) {
+	result := "success"
+	for _, r := range rsp.GetResults() {
+		switch r.GetSeverity() {
+		case fnv1.Severity_SEVERITY_FATAL:
+			result = "fatal"
+		case fnv1.Severity_SEVERITY_WARNING:
+			if result == "success" {
+				result = "warning"
+			}
+		}
+	}
+
+	runDuration.WithLabelValues(result).Observe(time.Since(start).Seconds())
+}
+
+// withTelemetry instruments all AWS API calls made with the config with
+// metrics and spans
+func withTelemetry(cfg aws.Config) aws.Config {
+	return withAPIOptions(cfg, addMetricsMiddleware, addTracingMiddleware)
+}
+
+func addMetricsMiddleware(stack *middleware.Stack) error {
+	err := stack.Initialize.Add(middleware.InitializeMiddlewareFunc("IRSARequestMetrics", func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (out middleware.InitializeOutput, md middleware.Metadata, err error) {
+		start := time.Now()
+		out, md, err = next.HandleInitialize(ctx, in)
+
+		service, operation := awsmiddleware.GetServiceID(ctx), awsmiddleware.GetOperationName(ctx)
+		result := "success"
+		if err != nil {
+			result = "error"
+		}
+		awsRequests.WithLabelValues(service, operation, result).Inc()
+		awsRequestDuration.WithLabelValues(service, operation).Observe(time.Since(start).Seconds())
+		return
+	}), middleware.After)
+	if err != nil {
+		return err
+	}
+
+	// Inserted after the retry middleware so that every attempt is seen
+	return stack.Finalize.Insert(middleware.FinalizeMiddlewareFunc("IRSAAttemptMetrics", func(ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler) (out middleware.FinalizeOutput, md middleware.Metadata, err error) {
+		out, md, err = next.HandleFinalize(ctx, in)
+		if err == nil {
+			return
+		}
+
+		reason := "error"
+		if retry.IsErrorThrottles(retry.DefaultThrottles).IsErrorThrottle(err) == aws.TrueTernary {
+			reason = "throttle"
+		}
+		awsAttemptErrors.WithLabelValues(awsmiddleware.GetServiceID(ctx), awsmiddleware.GetOperationName(ctx), reason).Inc()
+		return
+	}), "Retry", middleware.After)
+}
+
+// xrTracker counts the XRs currently in a given state.
+type xrTracker struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+// Set records whether the XR is in the tracked state
+func (t *xrTracker) Set(xr string, in bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if in {
+		t.seen[xr] = now()
+	} else {
+		delete(t.seen, xr)
+	}
+}
+
+// Count returns the number of XRs in the tracked state, forgetting XRs that
+// have not been reconciled for a while
+func (t *xrTracker) Count() float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for xr, seen := range t.seen {
+		if now().Sub(seen) > keysMissingStaleness {
+			delete(t.seen, xr)
+		}
+	}
+	return float64(len(t.seen))
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"crypto/md5" // #nosec G501 -- matches the sourceHash used by the composition
+	"encoding/base64"
+	"encoding/hex"
+
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+	"github.com/giantswarm/xfnlib/pkg/composite"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/giantswarm/crossplane-fn-irsa/pkg/input/v1beta1"
+)
+
+const (
+	bucketObjectAPIVersion = "s3.aws.upbound.io/v1beta1"
+	bucketObjectKind       = "BucketObject"
+
+	discoveryObjectKey = ".well-known/openid-configuration"
+	keysObjectKey      = "keys.json"
+
+	defaultObjectCacheControl = "max-age=300"
+)
+
+// BucketObjectParams describes where the OIDC documents are uploaded to.
+type BucketObjectParams struct {
+	// Name is the prefix of the composed resource names, usually the XR name
+	Name           string
+	BucketName     string
+	Region         string
+	ProviderConfig string
+}
+
+// ComposeBucketObjects adds the BucketObjects holding the discovery document
+// and the JWKS to the desired composed resources. A document that is nil is
+// not composed.
+//
+// The resources are named <name>-discovery and <name>-keys, matching the
+// names the bundled composition renders them under.
+func (f *Function) ComposeBucketObjects(spec *v1beta1.BucketObjects, params BucketObjectParams, discovery, jwks []byte, composed *composite.Composition) (err error) {
+	if spec == nil || !spec.Enabled {
+		return
+	}
+
+	cacheControl := defaultObjectCacheControl
+	if spec.CacheControl != "" {
+		cacheControl = spec.CacheControl
+	}
+
+	objects := []struct {
+		suffix  string
+		key     string
+		content []byte
+	}{
+		{"discovery", discoveryObjectKey, discovery},
+		{"keys", keysObjectKey, jwks},
+	}
+
+	for _, o := range objects {
+		if o.content == nil {
+			f.log.Debug("Skipping bucket object without content", "key", o.key)
+			continue
+		}
+
+		name := params.Name + "-" + o.suffix
+		if err = addDesiredResource(composed, bucketObject(name, o.key, cacheControl, params, o.content)); err != nil {
+			return errors.Wrapf(err, "cannot add bucket object %q", name)
+		}
+	}
+
+	return
+}
+
+// bucketObject renders a BucketObject uploading content as JSON
+func bucketObject(name, key, cacheControl string, params BucketObjectParams, content []byte) *unstructured.Unstructured {
+	encoded := base64.StdEncoding.EncodeToString(content)
+	hash := md5.Sum([]byte(encoded)) // #nosec G401
+
+	return &unstructured.Unstructured{
+		Object: map[string]any{
+			"apiVersion": bucketObjectAPIVersion,
+			"kind":       bucketObjectKind,
+			"metadata": map[string]any{
+				"name": name,
+			},
+			"spec": map[string]any{
+				"providerConfigRef": map[string]any{
+					"name": params.ProviderConfig,
+				},
+				"forProvider": map[string]any{
+					"bucketRef": map[string]any{
+						"name": params.BucketName,
+					},
+					"key":           key,
+					"contentType":   "application/json",
+					"cacheControl":  cacheControl,
+					"region":        params.Region,
+					"contentBase64": encoded,
+					"sourceHash":    hex.EncodeToString(hash[:]),
+					"tags":          map[string]any{},
+				},
+			},
+		},
+	}
+}
+
+// observedDocument returns a document previously patched to the XR, used when
+// it cannot be generated on this run.
+func (f *Function) observedDocument(ref string, oxr runtime.Object) []byte {
+	value, err := f.getStringFromPaved(oxr, ref)
+	if err != nil || value == "" {
+		return nil
+	}
+
+	b, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		f.log.Debug("Cannot decode observed document", "ref", ref, "error", err)
+		return nil
+	}
+
+	return b
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/crossplane/crossplane-runtime/pkg/fieldpath"
+	"github.com/crossplane/function-sdk-go/resource"
+
+	"github.com/giantswarm/crossplane-fn-irsa/pkg/input/v1beta1"
+)
+
+func TestComposeBucketObjects(t *testing.T) {
+	params := BucketObjectParams{
+		Name:           "test",
+		BucketName:     "test-irsa",
+		Region:         "eu-west-1",
+		ProviderConfig: "default",
+	}
+	discovery := []byte(`{"issuer":"https://irsa.test.example.com"}`)
+	jwks := []byte(`{"keys":[]}`)
+
+	cases := map[string]struct {
+		spec             *v1beta1.BucketObjects
+		discovery        []byte
+		wantObjects      map[string]string
+		wantCacheControl string
+	}{
+		"Disabled": {
+			spec:      &v1beta1.BucketObjects{},
+			discovery: discovery,
+		},
+		"Enabled": {
+			spec:             &v1beta1.BucketObjects{Enabled: true},
+			discovery:        discovery,
+			wantObjects:      map[string]string{"test-discovery": discoveryObjectKey, "test-keys": keysObjectKey},
+			wantCacheControl: defaultObjectCacheControl,
+		},
+		"CacheControl": {
+			spec:             &v1beta1.BucketObjects{Enabled: true, CacheControl: "no-cache"},
+			discovery:        discovery,
+			wantObjects:      map[string]string{"test-discovery": discoveryObjectKey, "test-keys": keysObjectKey},
+			wantCacheControl: "no-cache",
+		},
+		"WithoutDiscovery": {
+			spec:             &v1beta1.BucketObjects{Enabled: true},
+			wantObjects:      map[string]string{"test-keys": keysObjectKey},
+			wantCacheControl: defaultObjectCacheControl,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, c := newTestComposition(map[string]any{})
+
+			if err := newTestFunction().ComposeBucketObjects(tc.spec, params, tc.discovery, jwks, c); err != nil {
+				t.Fatalf("ComposeBucketObjects() error = %v", err)
+			}
+
+			if len(c.DesiredComposed) != len(tc.wantObjects) {
+				t.Fatalf("desired resources = %d, want %d", len(c.DesiredComposed), len(tc.wantObjects))
+			}
+			for name, key := range tc.wantObjects {
+				dc, ok := c.DesiredComposed[resource.Name(name)]
+				if !ok {
+					t.Fatalf("desired resource %s missing", name)
+				}
+				paved := fieldpath.Pave(dc.Resource.Object)
+
+				for path, want := range map[string]string{
+					"apiVersion":                      bucketObjectAPIVersion,
+					"kind":                            bucketObjectKind,
+					"spec.providerConfigRef.name":     "default",
+					"spec.forProvider.bucketRef.name": "test-irsa",
+					"spec.forProvider.region":         "eu-west-1",
+					"spec.forProvider.key":            key,
+					"spec.forProvider.cacheControl":   tc.wantCacheControl,
+					"spec.forProvider.contentType":    "application/json",
+				} {
+					if got, _ := paved.GetString(path); got != want {
+						t.Errorf("%s %s = %q, want %q", name, path, got, want)
+					}
+				}
+
+				content := jwks
+				if key == discoveryObjectKey {
+					content = tc.discovery
+				}
+				if got, _ := paved.GetString("spec.forProvider.contentBase64"); got != base64.StdEncoding.EncodeToString(content) {
+					t.Errorf("%s contentBase64 = %q, want the encoded document", name, got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"strings"
+)
+
+// Partition describes the properties of an AWS partition that affect how the
+// OIDC issuer is published.
+type Partition struct {
+	// ID is the partition as used in ARNs, e.g. aws, aws-cn or aws-us-gov
+	ID string
+
+	// DNSSuffix is the domain service endpoints live under
+	DNSSuffix string
+
+	// CloudFront is true if the issuer can be served through CloudFront with
+	// an ACM certificate. Otherwise the public S3 endpoint is used.
+	CloudFront bool
+}
+
+var (
+	partitionAWS = Partition{ID: "aws", DNSSuffix: "amazonaws.com", CloudFront: true}
+
+	// partitions maps region prefixes to their partition. More specific
+	// prefixes must come first.
+	partitions = []struct {
+		prefix    string
+		partition Partition
+	}{
+		{"cn-", Partition{ID: "aws-cn", DNSSuffix: "amazonaws.com.cn"}},
+		{"us-gov-", Partition{ID: "aws-us-gov", DNSSuffix: "amazonaws.com"}},
+		{"us-isob-", Partition{ID: "aws-iso-b", DNSSuffix: "sc2s.sgov.gov"}},
+		{"us-isof-", Partition{ID: "aws-iso-f", DNSSuffix: "csp.hci.ic.gov"}},
+		{"us-iso-", Partition{ID: "aws-iso", DNSSuffix: "c2s.ic.gov"}},
+		{"eu-isoe-", Partition{ID: "aws-iso-e", DNSSuffix: "cloud.adc-e.uk"}},
+	}
+)
+
+// PartitionForRegion returns the partition the region belongs to. Unknown
+// regions are assumed to be in the commercial partition.
+func PartitionForRegion(region string) Partition {
+	for _, p := range partitions {
+		if strings.HasPrefix(region, p.prefix) {
+			return p.partition
+		}
+	}
+	return partitionAWS
+}
+
+// ARNPrefix returns the prefix of ARNs of the given service in the partition
+func (p Partition) ARNPrefix(service string) string {
+	return "arn:" + p.ID + ":" + service + ":"
+}
+
+// S3Endpoint returns the public regional S3 endpoint
+func (p Partition) S3Endpoint(region string) string {
+	return "s3." + region + "." + p.DNSSuffix
+}
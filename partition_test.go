@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestPartitionForRegion(t *testing.T) {
+	cases := map[string]struct {
+		region string
+		want   Partition
+	}{
+		"Commercial":     {region: "eu-west-1", want: Partition{ID: "aws", DNSSuffix: "amazonaws.com", CloudFront: true}},
+		"Unknown":        {region: "xx-new-1", want: Partition{ID: "aws", DNSSuffix: "amazonaws.com", CloudFront: true}},
+		"China":          {region: "cn-north-1", want: Partition{ID: "aws-cn", DNSSuffix: "amazonaws.com.cn"}},
+		"ChinaNorthwest": {region: "cn-northwest-1", want: Partition{ID: "aws-cn", DNSSuffix: "amazonaws.com.cn"}},
+		"GovCloud":       {region: "us-gov-west-1", want: Partition{ID: "aws-us-gov", DNSSuffix: "amazonaws.com"}},
+		"GovCloudEast":   {region: "us-gov-east-1", want: Partition{ID: "aws-us-gov", DNSSuffix: "amazonaws.com"}},
+		"ISO":            {region: "us-iso-east-1", want: Partition{ID: "aws-iso", DNSSuffix: "c2s.ic.gov"}},
+		"ISOB":           {region: "us-isob-east-1", want: Partition{ID: "aws-iso-b", DNSSuffix: "sc2s.sgov.gov"}},
+		"ISOF":           {region: "us-isof-south-1", want: Partition{ID: "aws-iso-f", DNSSuffix: "csp.hci.ic.gov"}},
+		"ISOE":           {region: "eu-isoe-west-1", want: Partition{ID: "aws-iso-e", DNSSuffix: "cloud.adc-e.uk"}},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if got := PartitionForRegion(tc.region); got != tc.want {
+				t.Errorf("PartitionForRegion(%q) = %+v, want %+v", tc.region, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestPartitionARNPrefix(t *testing.T) {
+	for region, want := range map[string]string{
+		"eu-west-1":     "arn:aws:iam:",
+		"cn-north-1":    "arn:aws-cn:iam:",
+		"us-gov-west-1": "arn:aws-us-gov:iam:",
+	} {
+		if got := PartitionForRegion(region).ARNPrefix("iam"); got != want {
+			t.Errorf("ARNPrefix() in %s = %q, want %q", region, got, want)
+		}
+	}
+}
@@ -23,6 +23,19 @@ type Input struct {
 	Spec *Spec `json:"spec,omitempty"`
 }
 
+// DiscoveryPolicy - Defines when AWS discovery is run
+// +kubebuilder:validation:Enum=Always;IfMissing
+type DiscoveryPolicy string
+
+const (
+	// DiscoveryPolicyAlways runs discovery on every reconcile
+	DiscoveryPolicyAlways DiscoveryPolicy = "Always"
+
+	// DiscoveryPolicyIfMissing carries previously discovered values forward
+	// and only runs discovery for values not yet recorded on the XR
+	DiscoveryPolicyIfMissing DiscoveryPolicy = "IfMissing"
+)
+
 // Spec - Defines the spec given to this input type, providing the required, and optional elements that may be defined
 type Spec struct {
 	// +optional
@@ -31,18 +44,313 @@ type Spec struct {
 	// +optional
 	Route53HostedZonePatchToRef string `json:"route53HostedZonePatchToRef"`
 
+	// HostedZoneDiscovery tunes how the Route53 hosted zone for the domain is
+	// selected. By default exactly one zone named after the domain must exist.
+	// +optional
+	HostedZoneDiscovery *HostedZoneDiscovery `json:"hostedZoneDiscovery,omitempty"`
+
 	// +required
 	S3KeysPatchToRef string `json:"s3KeysPatchToRef"`
 
+	// KeyIDPatchToRef is the path to patch the key ID (kid) of the current
+	// signing key to
+	// +optional
+	KeyIDPatchToRef string `json:"keyIDPatchToRef,omitempty"`
+
+	// S3KeysHistoryPatchToRef is the path on the XR at which previously
+	// published signing keys are retained. When set, keys rotated out of the
+	// service account secret remain in the JWKS until the overlap window
+	// has elapsed.
+	// +optional
+	S3KeysHistoryPatchToRef string `json:"s3KeysHistoryPatchToRef,omitempty"`
+
+	// KeyRotationOverlap is how long a rotated-out signing key continues to
+	// be published. Defaults to 24h.
+	// +optional
+	KeyRotationOverlap *metav1.Duration `json:"keyRotationOverlap,omitempty"`
+
 	// +required
 	S3BucketNameRef string `json:"s3BucketNameRef"`
 
 	// +required
 	S3DiscoveryPatchToRef string `json:"s3DiscoveryPatchToRef"`
 
+	// BucketObjects makes the function compose the S3 BucketObjects holding
+	// the discovery document and JWKS itself
+	// +optional
+	BucketObjects *BucketObjects `json:"bucketObjects,omitempty"`
+
+	// Thumbprint computes the TLS thumbprint of the issuer for the IAM
+	// OpenID Connect provider
+	// +optional
+	Thumbprint *Thumbprint `json:"thumbprint,omitempty"`
+
+	// DryRun performs all discovery and document generation but reports the
+	// resulting changes as results instead of applying them. It can also be
+	// enabled per XR with the irsa.fn.giantswarm.io/dry-run annotation.
+	// +optional
+	DryRun bool `json:"dryRun,omitempty"`
+
+	// Rendering selects what composes the IRSA managed resources
+	// +optional
+	Rendering *Rendering `json:"rendering,omitempty"`
+
+	// IssuerURLPatchToRef is the path to patch the OIDC issuer URL to
+	// +optional
+	IssuerURLPatchToRef string `json:"issuerURLPatchToRef,omitempty"`
+
+	// JWKSURIPatchToRef is the path to patch the URI of the published JWKS to
+	// +optional
+	JWKSURIPatchToRef string `json:"jwksURIPatchToRef,omitempty"`
+
+	// IssuerModePatchToRef is the path to patch the resolved issuer mode to,
+	// so that renderers in later steps serve the issuer the same way
+	// +optional
+	IssuerModePatchToRef string `json:"issuerModePatchToRef,omitempty"`
+
 	// +required
 	RegionRef string `json:"regionRef"`
 
+	// IssuerMode selects how the OIDC issuer is published. Defaults to
+	// CloudFront in partitions where it is available and S3PathStyle
+	// elsewhere.
+	// +optional
+	IssuerMode IssuerMode `json:"issuerMode,omitempty"`
+
+	// CustomIssuerURLRef is the path on the XR from which to read the issuer
+	// URL when IssuerMode is Custom.
+	// +optional
+	CustomIssuerURLRef string `json:"customIssuerURLRef,omitempty"`
+
+	// ServiceAccountSecret defines where the service account signing key is
+	// read from. Defaults to the `tls.key` of the `<claim-name>-sa` secret in
+	// the claim namespace.
+	// +optional
+	ServiceAccountSecret *ServiceAccountSecret `json:"serviceAccountSecret,omitempty"`
+
+	// FailOnMissingKeys makes the function fail when the service account
+	// signing key cannot be read. By default a warning is emitted and the
+	// KeysGenerated condition is set to false.
+	// +optional
+	FailOnMissingKeys bool `json:"failOnMissingKeys,omitempty"`
+
 	// +required
 	ProviderConfigRef string `json:"providerConfigRef"`
+
+	// DNSProviderConfigRef is the path on the XR of the ProviderConfig used
+	// for Route53 discovery. Falls back to ProviderConfigRef when unset or
+	// empty on the XR.
+	// +optional
+	DNSProviderConfigRef string `json:"dnsProviderConfigRef,omitempty"`
+
+	// CloudFrontProviderConfigRef is the path on the XR of the
+	// ProviderConfig used for CloudFront discovery and the rendered
+	// CloudFront resources. Falls back to ProviderConfigRef when unset or
+	// empty on the XR.
+	// +optional
+	CloudFrontProviderConfigRef string `json:"cloudFrontProviderConfigRef,omitempty"`
+
+	// IAMProviderConfigRef is the path on the XR of the ProviderConfig used
+	// for OpenID Connect provider discovery. Falls back to ProviderConfigRef
+	// when unset or empty on the XR.
+	// +optional
+	IAMProviderConfigRef string `json:"iamProviderConfigRef,omitempty"`
+
+	// DiscoveryPolicy controls whether AWS discovery runs on every
+	// reconcile or only when no previously discovered values are recorded
+	// on the XR.
+	// +optional
+	// +kubebuilder:default=Always
+	DiscoveryPolicy DiscoveryPolicy `json:"discoveryPolicy,omitempty"`
+
+	// DiscoveryRefreshInterval forces discovery to run again once this long
+	// has passed since the last discovery when DiscoveryPolicy is IfMissing.
+	// +optional
+	DiscoveryRefreshInterval *metav1.Duration `json:"discoveryRefreshInterval,omitempty"`
+
+	// Timeouts bounds how long each step may take. A step that times out
+	// reuses the values recorded on the XR and is reported as a Warning.
+	// +optional
+	Timeouts *Timeouts `json:"timeouts,omitempty"`
+}
+
+// Timeouts - Defines how long each step may take. Steps without a timeout use
+// Default, or the --step-timeout flag of the function if Default is unset.
+type Timeouts struct {
+	// +optional
+	Default *metav1.Duration `json:"default,omitempty"`
+
+	// +optional
+	HostedZone *metav1.Duration `json:"hostedZone,omitempty"`
+
+	// +optional
+	Distribution *metav1.Duration `json:"distribution,omitempty"`
+
+	// +optional
+	Thumbprint *metav1.Duration `json:"thumbprint,omitempty"`
+
+	// +optional
+	OIDCProvider *metav1.Duration `json:"oidcProvider,omitempty"`
+
+	// +optional
+	ServiceAccountSecret *metav1.Duration `json:"serviceAccountSecret,omitempty"`
+}
+
+// BucketObjects - Defines how the discovery document and JWKS are uploaded
+type BucketObjects struct {
+	// Enabled adds s3.aws.upbound.io BucketObjects for the discovery document
+	// and JWKS to the desired composed resources
+	// +optional
+	Enabled bool `json:"enabled,omitempty"`
+
+	// CacheControl is the Cache-Control header served with both documents.
+	// Defaults to max-age=300.
+	// +optional
+	CacheControl string `json:"cacheControl,omitempty"`
+}
+
+// ThumbprintSource - Defines where the issuer thumbprint is computed from
+// +kubebuilder:validation:Enum=Auto;CABundle;TLS;Offline
+type ThumbprintSource string
+
+const (
+	// ThumbprintSourceAuto uses the CA bundle if set, otherwise connects to
+	// the issuer, falling back to the known thumbprint of the endpoint
+	ThumbprintSourceAuto ThumbprintSource = "Auto"
+
+	// ThumbprintSourceCABundle uses the root CA of the CA bundle
+	ThumbprintSourceCABundle ThumbprintSource = "CABundle"
+
+	// ThumbprintSourceTLS uses the root CA presented by the issuer host
+	ThumbprintSourceTLS ThumbprintSource = "TLS"
+
+	// ThumbprintSourceOffline uses the known thumbprint of the partition and
+	// endpoint without any network access
+	ThumbprintSourceOffline ThumbprintSource = "Offline"
+)
+
+// Thumbprint - Defines how the issuer thumbprint is computed
+type Thumbprint struct {
+	// Source selects where the thumbprint is computed from. Defaults to Auto.
+	// +optional
+	// +kubebuilder:default=Auto
+	Source ThumbprintSource `json:"source,omitempty"`
+
+	// CABundleRef is the path on the XR of a PEM encoded CA bundle for the
+	// issuer
+	// +optional
+	CABundleRef string `json:"caBundleRef,omitempty"`
+
+	// PatchToRef is the path to patch the thumbprint list to
+	// +required
+	PatchToRef string `json:"patchToRef"`
+}
+
+// Renderer - Defines what renders the IRSA managed resources
+// +kubebuilder:validation:Enum=KCL;Native
+type Renderer string
+
+const (
+	// RendererKCL leaves rendering to a later pipeline step, by default the
+	// function-kcl step of the bundled composition
+	RendererKCL Renderer = "KCL"
+
+	// RendererNative makes this function compose all managed resources
+	RendererNative Renderer = "Native"
+)
+
+// Rendering - Defines how the IRSA managed resources are rendered
+type Rendering struct {
+	// Renderer selects what renders the managed resources. Defaults to KCL.
+	// +optional
+	// +kubebuilder:default=KCL
+	Renderer Renderer `json:"renderer,omitempty"`
+
+	// TagsRef is the path on the XR of the tags applied to the resources
+	// +optional
+	TagsRef string `json:"tagsRef,omitempty"`
+
+	// ClusterNameRef is the path on the XR of the cluster name. When no tags
+	// are set, resources are tagged with giantswarm.io/cluster: <name>.
+	// +optional
+	ClusterNameRef string `json:"clusterNameRef,omitempty"`
+}
+
+// IssuerMode - Defines where the OIDC issuer is served from
+// +kubebuilder:validation:Enum=CloudFront;S3PathStyle;S3VirtualHost;Custom
+type IssuerMode string
+
+const (
+	// IssuerModeCloudFront serves the issuer from CloudFront on irsa.<domain>
+	IssuerModeCloudFront IssuerMode = "CloudFront"
+
+	// IssuerModeS3PathStyle serves the issuer from the path-style public S3
+	// endpoint, https://s3.<region>.<suffix>/<bucket>
+	IssuerModeS3PathStyle IssuerMode = "S3PathStyle"
+
+	// IssuerModeS3VirtualHost serves the issuer from the virtual-hosted
+	// public S3 endpoint, https://<bucket>.s3.<region>.<suffix>
+	IssuerModeS3VirtualHost IssuerMode = "S3VirtualHost"
+
+	// IssuerModeCustom uses an issuer URL read from the XR, e.g. a CDN
+	// fronting the bucket
+	IssuerModeCustom IssuerMode = "Custom"
+)
+
+// HostedZoneVisibility - Defines whether public or private zones are preferred
+// +kubebuilder:validation:Enum=Public;Private
+type HostedZoneVisibility string
+
+const (
+	// HostedZoneVisibilityPublic prefers public hosted zones
+	HostedZoneVisibilityPublic HostedZoneVisibility = "Public"
+
+	// HostedZoneVisibilityPrivate prefers private hosted zones
+	HostedZoneVisibilityPrivate HostedZoneVisibility = "Private"
+)
+
+// HostedZoneDiscovery - Defines how the Route53 hosted zone is selected
+type HostedZoneDiscovery struct {
+	// Prefer selects zones of this visibility when zones of both
+	// visibilities match.
+	// +optional
+	Prefer HostedZoneVisibility `json:"prefer,omitempty"`
+
+	// VPCIDRef is the path on the XR from which to read a VPC ID. When set,
+	// only private zones associated with that VPC are considered.
+	// +optional
+	VPCIDRef string `json:"vpcIdRef,omitempty"`
+
+	// Tags that a hosted zone must carry to be considered.
+	// +optional
+	Tags map[string]string `json:"tags,omitempty"`
+
+	// FallbackToParent walks up the labels of the domain and selects the
+	// closest parent zone when no zone exists for the domain itself.
+	// +optional
+	FallbackToParent bool `json:"fallbackToParent,omitempty"`
+}
+
+// ServiceAccountSecret - Defines the secret holding the service account signing key
+type ServiceAccountSecret struct {
+	// NameRef is the path on the XR from which to read the secret name. Takes
+	// precedence over NameTemplate.
+	// +optional
+	NameRef string `json:"nameRef,omitempty"`
+
+	// NameTemplate is a Go template rendering the secret name. The template
+	// has access to `.Name`, `.ClaimName`, `.ClaimNamespace`, `.Labels` and
+	// `.Spec` of the XR. Defaults to `{{ .ClaimName }}-sa`.
+	// +optional
+	NameTemplate string `json:"nameTemplate,omitempty"`
+
+	// NamespaceRef is the path on the XR from which to read the secret
+	// namespace. Defaults to the claim namespace.
+	// +optional
+	NamespaceRef string `json:"namespaceRef,omitempty"`
+
+	// Key is the secret data key holding the signing key. When unset the
+	// first of `tls.key`, `tls.crt` and `sa.pub` found is used.
+	// +optional
+	Key string `json:"key,omitempty"`
 }
@@ -5,9 +5,47 @@
 package v1beta1
 
 import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BucketObjects) DeepCopyInto(out *BucketObjects) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BucketObjects.
+func (in *BucketObjects) DeepCopy() *BucketObjects {
+	if in == nil {
+		return nil
+	}
+	out := new(BucketObjects)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HostedZoneDiscovery) DeepCopyInto(out *HostedZoneDiscovery) {
+	*out = *in
+	if in.Tags != nil {
+		in, out := &in.Tags, &out.Tags
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HostedZoneDiscovery.
+func (in *HostedZoneDiscovery) DeepCopy() *HostedZoneDiscovery {
+	if in == nil {
+		return nil
+	}
+	out := new(HostedZoneDiscovery)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Input) DeepCopyInto(out *Input) {
 	*out = *in
@@ -16,7 +54,7 @@ func (in *Input) DeepCopyInto(out *Input) {
 	if in.Spec != nil {
 		in, out := &in.Spec, &out.Spec
 		*out = new(Spec)
-		**out = **in
+		(*in).DeepCopyInto(*out)
 	}
 }
 
@@ -38,9 +76,79 @@ func (in *Input) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Rendering) DeepCopyInto(out *Rendering) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Rendering.
+func (in *Rendering) DeepCopy() *Rendering {
+	if in == nil {
+		return nil
+	}
+	out := new(Rendering)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ServiceAccountSecret) DeepCopyInto(out *ServiceAccountSecret) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServiceAccountSecret.
+func (in *ServiceAccountSecret) DeepCopy() *ServiceAccountSecret {
+	if in == nil {
+		return nil
+	}
+	out := new(ServiceAccountSecret)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Spec) DeepCopyInto(out *Spec) {
 	*out = *in
+	if in.HostedZoneDiscovery != nil {
+		in, out := &in.HostedZoneDiscovery, &out.HostedZoneDiscovery
+		*out = new(HostedZoneDiscovery)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.KeyRotationOverlap != nil {
+		in, out := &in.KeyRotationOverlap, &out.KeyRotationOverlap
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.BucketObjects != nil {
+		in, out := &in.BucketObjects, &out.BucketObjects
+		*out = new(BucketObjects)
+		**out = **in
+	}
+	if in.Thumbprint != nil {
+		in, out := &in.Thumbprint, &out.Thumbprint
+		*out = new(Thumbprint)
+		**out = **in
+	}
+	if in.Rendering != nil {
+		in, out := &in.Rendering, &out.Rendering
+		*out = new(Rendering)
+		**out = **in
+	}
+	if in.ServiceAccountSecret != nil {
+		in, out := &in.ServiceAccountSecret, &out.ServiceAccountSecret
+		*out = new(ServiceAccountSecret)
+		**out = **in
+	}
+	if in.DiscoveryRefreshInterval != nil {
+		in, out := &in.DiscoveryRefreshInterval, &out.DiscoveryRefreshInterval
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.Timeouts != nil {
+		in, out := &in.Timeouts, &out.Timeouts
+		*out = new(Timeouts)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Spec.
@@ -52,3 +160,63 @@ func (in *Spec) DeepCopy() *Spec {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Thumbprint) DeepCopyInto(out *Thumbprint) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Thumbprint.
+func (in *Thumbprint) DeepCopy() *Thumbprint {
+	if in == nil {
+		return nil
+	}
+	out := new(Thumbprint)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Timeouts) DeepCopyInto(out *Timeouts) {
+	*out = *in
+	if in.Default != nil {
+		in, out := &in.Default, &out.Default
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.HostedZone != nil {
+		in, out := &in.HostedZone, &out.HostedZone
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.Distribution != nil {
+		in, out := &in.Distribution, &out.Distribution
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.Thumbprint != nil {
+		in, out := &in.Thumbprint, &out.Thumbprint
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.OIDCProvider != nil {
+		in, out := &in.OIDCProvider, &out.OIDCProvider
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.ServiceAccountSecret != nil {
+		in, out := &in.ServiceAccountSecret, &out.ServiceAccountSecret
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Timeouts.
+func (in *Timeouts) DeepCopy() *Timeouts {
+	if in == nil {
+		return nil
+	}
+	out := new(Timeouts)
+	in.DeepCopyInto(out)
+	return out
+}
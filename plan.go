@@ -0,0 +1,378 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/crossplane/crossplane-runtime/pkg/fieldpath"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+	"github.com/crossplane/function-sdk-go/resource/composed"
+	"github.com/crossplane/function-sdk-go/response"
+	"github.com/giantswarm/xfnlib/pkg/composite"
+
+	"github.com/giantswarm/crossplane-fn-irsa/pkg/input/v1beta1"
+)
+
+// dryRunAnnotation makes the function report its changes instead of applying
+// them when set to "true" on the XR
+const dryRunAnnotation = "irsa.fn.giantswarm.io/dry-run"
+
+// maxPlanValueLength truncates values in change descriptions
+const maxPlanValueLength = 120
+
+// isDryRun reports whether changes should only be reported
+func (f *Function) isDryRun(spec *v1beta1.Spec, oxr *resource.Composite) bool {
+	return spec.DryRun || oxr.Resource.GetAnnotations()[dryRunAnnotation] == "true"
+}
+
+// plan is a snapshot of the desired state handed to the function, taken
+// before anything is patched or composed.
+type plan struct {
+	composite map[string]any
+	composed  map[resource.Name]*resource.DesiredComposed
+}
+
+// newPlan snapshots the desired state of the request
+func newPlan(c *composite.Composition) *plan {
+	p := &plan{
+		composite: c.DesiredComposite.Resource.DeepCopy().Object,
+		composed:  make(map[resource.Name]*resource.DesiredComposed, len(c.DesiredComposed)),
+	}
+
+	for name, dc := range c.DesiredComposed {
+		p.composed[name] = &resource.DesiredComposed{
+			Resource: dc.Resource.DeepCopy(),
+			Ready:    dc.Ready,
+		}
+	}
+
+	return p
+}
+
+// Report emits a Normal result for every change the function made to the
+// desired state compared to the observed state, then reverts the desired
+// state so that nothing is written.
+//
+// Values already recorded on the observed XR are kept in the desired XR, and
+// existing composed resources keep their observed spec, so that dropping the
+// function's changes does not remove anything.
+func (p *plan) Report(rsp *fnv1.RunFunctionResponse, spec *v1beta1.Spec, oxr *resource.Composite, c *composite.Composition) {
+	var changes []string
+
+	before := normalize(p.composite)
+	after := normalize(c.DesiredComposite.Resource.Object)
+	observed := normalize(oxr.Resource.Object)
+
+	restored := fieldpath.Pave(c.DesiredComposite.Resource.DeepCopy().Object)
+	for _, path := range changedPaths(before, after) {
+		observedValue, observedErr := fieldpath.Pave(observed).GetValue(path)
+		desiredValue, _ := fieldpath.Pave(after).GetValue(path)
+
+		// Prefer what earlier pipeline steps set, then what was written on
+		// previous runs
+		if beforeValue, err := fieldpath.Pave(before).GetValue(path); err == nil {
+			_ = restored.SetValue(path, beforeValue)
+		} else if observedErr == nil {
+			_ = restored.SetValue(path, observedValue)
+		} else {
+			_ = restored.DeleteField(path)
+		}
+
+		if path == lastDiscoveryTimeRef || reflect.DeepEqual(observedValue, desiredValue) {
+			continue
+		}
+		changes = append(changes, describeChange(path, observedValue, desiredValue, spec))
+	}
+
+	c.DesiredComposite.Resource.Object = restored.UnstructuredContent()
+
+	names := make([]string, 0, len(c.DesiredComposed))
+	for name := range c.DesiredComposed {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+
+	for _, n := range names {
+		name := resource.Name(n)
+		dc := c.DesiredComposed[name]
+		if prev, ok := p.composed[name]; ok && reflect.DeepEqual(prev.Resource.Object, dc.Resource.Object) {
+			continue
+		}
+
+		oc, exists := c.ObservedComposed[name]
+		if !exists {
+			changes = append(changes, fmt.Sprintf("would create %s %q", dc.Resource.GetKind(), n))
+			if prev, ok := p.composed[name]; ok {
+				c.DesiredComposed[name] = prev
+			} else {
+				delete(c.DesiredComposed, name)
+			}
+			continue
+		}
+
+		wanted := normalize(dc.Resource.Object)
+		current := normalize(oc.Resource.Object)
+		if fields := changedFields(wanted, current, "spec"); len(fields) > 0 {
+			changes = append(changes, fmt.Sprintf("would update %s %q: %s", dc.Resource.GetKind(), n, strings.Join(fields, ", ")))
+		}
+
+		if prev, ok := p.composed[name]; ok {
+			c.DesiredComposed[name] = prev
+		} else {
+			c.DesiredComposed[name] = observedAsDesired(oc)
+		}
+	}
+
+	if len(changes) == 0 {
+		response.Normal(rsp, "dry run: no changes")
+		return
+	}
+
+	for _, change := range changes {
+		response.Normal(rsp, "dry run: "+change)
+	}
+}
+
+// quiet turns the conditions and warnings of a dry run into Normal results on
+// the XR, so that neither the XR nor the claim is changed by a dry run.
+// Fatal results are kept as they stop the pipeline regardless.
+func (p *plan) quiet(rsp *fnv1.RunFunctionResponse) {
+	results := make([]*fnv1.Result, 0, len(rsp.GetResults())+len(rsp.GetConditions()))
+	for _, r := range rsp.GetResults() {
+		if r.GetSeverity() == fnv1.Severity_SEVERITY_WARNING {
+			r = &fnv1.Result{
+				Severity: fnv1.Severity_SEVERITY_NORMAL,
+				Message:  "dry run: warning: " + r.GetMessage(),
+				Reason:   r.Reason,
+			}
+		}
+		results = append(results, r)
+	}
+
+	for _, c := range rsp.GetConditions() {
+		message := fmt.Sprintf("dry run: would set condition %s to %s (%s)", c.GetType(), conditionStatus(c.GetStatus()), c.GetReason())
+		if c.GetMessage() != "" {
+			message += ": " + c.GetMessage()
+		}
+		results = append(results, &fnv1.Result{
+			Severity: fnv1.Severity_SEVERITY_NORMAL,
+			Message:  message,
+		})
+	}
+
+	rsp.Results = results
+	rsp.Conditions = nil
+}
+
+func conditionStatus(s fnv1.Status) string {
+	switch s {
+	case fnv1.Status_STATUS_CONDITION_TRUE:
+		return "True"
+	case fnv1.Status_STATUS_CONDITION_FALSE:
+		return "False"
+	default:
+		return "Unknown"
+	}
+}
+
+// observedAsDesired returns an existing composed resource with its observed
+// spec, so that it is kept unchanged.
+func observedAsDesired(oc resource.ObservedComposed) *resource.DesiredComposed {
+	u := composed.New()
+	u.SetAPIVersion(oc.Resource.GetAPIVersion())
+	u.SetKind(oc.Resource.GetKind())
+	u.SetName(oc.Resource.GetName())
+	u.SetAnnotations(oc.Resource.GetAnnotations())
+
+	if spec, ok := oc.Resource.Object["spec"]; ok {
+		u.Object["spec"] = spec
+	}
+
+	return &resource.DesiredComposed{Resource: u}
+}
+
+// describeChange renders a change of an XR field. The JWKS and the discovery
+// document are summarised by their key IDs and issuer.
+func describeChange(path string, from, to any, spec *v1beta1.Spec) string {
+	switch path {
+	case spec.S3KeysPatchToRef:
+		added, removed := diffStrings(jwksKeyIDs(from), jwksKeyIDs(to))
+		return fmt.Sprintf("would change JWKS at %s: add kid %v, remove kid %v", path, added, removed)
+	case spec.S3DiscoveryPatchToRef:
+		return fmt.Sprintf("would change discovery document at %s: issuer %q to %q", path, discoveryIssuer(from), discoveryIssuer(to))
+	}
+
+	if from == nil {
+		return fmt.Sprintf("would set %s to %s", path, formatValue(to))
+	}
+	return fmt.Sprintf("would change %s from %s to %s", path, formatValue(from), formatValue(to))
+}
+
+func formatValue(v any) string {
+	b, _ := json.Marshal(v)
+	s := string(b)
+	if len(s) > maxPlanValueLength {
+		s = s[:maxPlanValueLength] + "..."
+	}
+	return s
+}
+
+// decodeDocument decodes a document patched to the XR, which is stored base64
+// encoded
+func decodeDocument(v any, into any) bool {
+	s, ok := v.(string)
+	if !ok {
+		return false
+	}
+
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return false
+	}
+
+	return json.Unmarshal(b, into) == nil
+}
+
+func jwksKeyIDs(v any) []string {
+	var keys struct {
+		Keys []struct {
+			KeyID string `json:"kid"`
+		} `json:"keys"`
+	}
+	if !decodeDocument(v, &keys) {
+		return nil
+	}
+
+	kids := make([]string, 0, len(keys.Keys))
+	for _, k := range keys.Keys {
+		kids = append(kids, k.KeyID)
+	}
+	return kids
+}
+
+func discoveryIssuer(v any) string {
+	var doc DiscoveryResponse
+	if !decodeDocument(v, &doc) {
+		return ""
+	}
+	return doc.Issuer
+}
+
+// diffStrings returns the values only in b and the values only in a
+func diffStrings(a, b []string) (added, removed []string) {
+	in := func(list []string, s string) bool {
+		for _, v := range list {
+			if v == s {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, s := range b {
+		if !in(a, s) {
+			added = append(added, s)
+		}
+	}
+	for _, s := range a {
+		if !in(b, s) {
+			removed = append(removed, s)
+		}
+	}
+	return
+}
+
+// normalize converts an object to its JSON representation so that values
+// patched as Go types compare equal to the same values read from a request.
+func normalize(obj map[string]any) map[string]any {
+	b, err := json.Marshal(obj)
+	if err != nil {
+		return obj
+	}
+
+	var out map[string]any
+	if err = json.Unmarshal(b, &out); err != nil {
+		return obj
+	}
+	return out
+}
+
+// changedPaths returns the field paths of all leaves that differ between the
+// two objects, in order. Lists are compared as a whole.
+func changedPaths(before, after map[string]any) []string {
+	var paths []string
+	walkChanges("", before, after, &paths)
+	sort.Strings(paths)
+	return paths
+}
+
+func walkChanges(prefix string, before, after any, paths *[]string) {
+	b, bok := before.(map[string]any)
+	a, aok := after.(map[string]any)
+
+	// Descend into objects that only exist on one side
+	if bok && after == nil {
+		a, aok = map[string]any{}, true
+	}
+	if aok && before == nil {
+		b, bok = map[string]any{}, true
+	}
+
+	if !bok || !aok {
+		if !reflect.DeepEqual(before, after) && prefix != "" {
+			*paths = append(*paths, prefix)
+		}
+		return
+	}
+
+	for k, v := range a {
+		walkChanges(joinPath(prefix, k), b[k], v, paths)
+	}
+	for k, v := range b {
+		if _, ok := a[k]; !ok {
+			walkChanges(joinPath(prefix, k), v, nil, paths)
+		}
+	}
+}
+
+// changedFields returns the paths below root at which wanted sets a value the
+// observed object does not have. Fields only present on the observed object,
+// such as late initialized ones, are ignored.
+func changedFields(wanted, observed map[string]any, root string) []string {
+	var fields []string
+	var walk func(prefix string, w, o any)
+	walk = func(prefix string, w, o any) {
+		wm, wok := w.(map[string]any)
+		om, ook := o.(map[string]any)
+		if wok && ook {
+			for k, v := range wm {
+				walk(joinPath(prefix, k), v, om[k])
+			}
+			return
+		}
+		if !reflect.DeepEqual(w, o) {
+			fields = append(fields, prefix)
+		}
+	}
+
+	walk(root, wanted[root], observed[root])
+	sort.Strings(fields)
+	return fields
+}
+
+// joinPath appends a key to a field path, using brackets for keys that are
+// not valid path segments
+func joinPath(prefix, key string) string {
+	if strings.ContainsAny(key, ".[]") {
+		return prefix + "[" + key + "]"
+	}
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"strings"
+	"testing"
+
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+	"github.com/crossplane/function-sdk-go/resource/composed"
+	"github.com/crossplane/function-sdk-go/response"
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/giantswarm/crossplane-fn-irsa/pkg/input/v1beta1"
+)
+
+func TestChangedPaths(t *testing.T) {
+	before := map[string]any{
+		"spec": map[string]any{"region": "eu-west-1", "keep": "same"},
+		"status": map[string]any{
+			"removed": "value",
+			"list":    []any{"a"},
+		},
+	}
+	after := map[string]any{
+		"spec": map[string]any{"region": "eu-central-1", "keep": "same"},
+		"status": map[string]any{
+			"list":  []any{"a", "b"},
+			"added": map[string]any{"nested": "value"},
+		},
+	}
+
+	want := []string{"spec.region", "status.added.nested", "status.list", "status.removed"}
+	if diff := cmp.Diff(want, changedPaths(before, after)); diff != "" {
+		t.Errorf("changedPaths() -want, +got:\n%s", diff)
+	}
+}
+
+func testComposed(apiVersion, kind, name string, spec map[string]any) *composed.Unstructured {
+	return &composed.Unstructured{Unstructured: unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": apiVersion,
+		"kind":       kind,
+		"metadata":   map[string]any{"name": name},
+		"spec":       spec,
+	}}}
+}
+
+// TestPlanReport ensures a dry run leaves the desired state as it was handed
+// to the function, apart from values recorded on previous runs
+func TestPlanReport(t *testing.T) {
+	spec := &v1beta1.Spec{S3KeysPatchToRef: "status.jwks"}
+
+	oxr, c := newTestComposition(map[string]any{
+		"status": map[string]any{
+			"importResources": map[string]any{"hostedZoneId": "Z123"},
+		},
+	})
+
+	// Set by an earlier step of the pipeline
+	c.DesiredComposite.Resource.Object["spec"] = map[string]any{"fromEarlierStep": "value"}
+	c.DesiredComposed["earlier"] = &resource.DesiredComposed{Resource: testComposed("example.org/v1", "Earlier", "earlier", map[string]any{"a": "b"})}
+
+	existing := testComposed("s3.aws.upbound.io/v1beta1", "Bucket", "bucket", map[string]any{"forProvider": map[string]any{"region": "eu-west-1"}})
+	existing.Object["status"] = map[string]any{"atProvider": map[string]any{"arn": "arn:aws:s3:::bucket"}}
+	c.ObservedComposed["bucket"] = resource.ObservedComposed{Resource: existing}
+
+	want := c.DesiredComposite.Resource.DeepCopy().Object
+	want["status"] = map[string]any{
+		"importResources": map[string]any{"hostedZoneId": "Z123"},
+	}
+	p := newPlan(c)
+
+	// Changes made by the function
+	f := newTestFunction()
+	for path, value := range map[string]any{
+		"spec.fromEarlierStep":                "changed",
+		"status.importResources.hostedZoneId": "Z456",
+		"status.importResources.distribution": "E123",
+		"status.jwks":                         "e30=",
+		lastDiscoveryTimeRef:                  "2026-01-01T00:00:00Z",
+	} {
+		if err := f.patchFieldValueToObject(path, value, c.DesiredComposite.Resource); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c.DesiredComposed["earlier"].Resource.Object["spec"] = map[string]any{"a": "changed"}
+	c.DesiredComposed["bucket"] = &resource.DesiredComposed{Resource: testComposed("s3.aws.upbound.io/v1beta1", "Bucket", "bucket", map[string]any{"forProvider": map[string]any{"region": "eu-central-1"}})}
+	c.DesiredComposed["new"] = &resource.DesiredComposed{Resource: testComposed("iam.aws.upbound.io/v1beta1", "OpenIDConnectProvider", "new", map[string]any{})}
+
+	rsp := &fnv1.RunFunctionResponse{}
+	p.Report(rsp, spec, oxr, c)
+
+	if diff := cmp.Diff(want, normalize(c.DesiredComposite.Resource.Object)); diff != "" {
+		t.Errorf("Report() desired XR -want, +got:\n%s", diff)
+	}
+
+	if _, ok := c.DesiredComposed["new"]; ok {
+		t.Errorf("Report() kept resource %q that does not exist", "new")
+	}
+	if diff := cmp.Diff(map[string]any{"a": "b"}, c.DesiredComposed["earlier"].Resource.Object["spec"]); diff != "" {
+		t.Errorf("Report() resource of an earlier step -want, +got:\n%s", diff)
+	}
+	if diff := cmp.Diff(existing.Object["spec"], c.DesiredComposed["bucket"].Resource.Object["spec"]); diff != "" {
+		t.Errorf("Report() existing resource -want, +got:\n%s", diff)
+	}
+
+	var messages []string
+	for _, r := range rsp.GetResults() {
+		if r.GetSeverity() != fnv1.Severity_SEVERITY_NORMAL {
+			t.Errorf("Report() result %q has severity %s", r.GetMessage(), r.GetSeverity())
+		}
+		messages = append(messages, r.GetMessage())
+	}
+	for _, substr := range []string{
+		`would change status.importResources.hostedZoneId from "Z123" to "Z456"`,
+		`would set status.importResources.distribution to "E123"`,
+		"would change JWKS at status.jwks",
+		`would create OpenIDConnectProvider "new"`,
+		`would update Bucket "bucket": spec.forProvider.region`,
+	} {
+		if !strings.Contains(strings.Join(messages, "\n"), substr) {
+			t.Errorf("Report() results %v do not contain %q", messages, substr)
+		}
+	}
+	for _, m := range messages {
+		if strings.Contains(m, lastDiscoveryTimeRef) {
+			t.Errorf("Report() reported %q", m)
+		}
+	}
+}
+
+func TestPlanReportNoChanges(t *testing.T) {
+	oxr, c := newTestComposition(nil)
+	p := newPlan(c)
+
+	rsp := &fnv1.RunFunctionResponse{}
+	p.Report(rsp, &v1beta1.Spec{}, oxr, c)
+
+	if len(rsp.GetResults()) != 1 || rsp.GetResults()[0].GetMessage() != "dry run: no changes" {
+		t.Errorf("Report() results = %v, want a single no changes result", rsp.GetResults())
+	}
+}
+
+func TestPlanQuiet(t *testing.T) {
+	rsp := &fnv1.RunFunctionResponse{}
+	response.Normal(rsp, "dry run: would set spec.a to 1")
+	response.Warning(rsp, context.DeadlineExceeded).WithReason(reasonTimedOut).TargetCompositeAndClaim()
+	response.ConditionTrue(rsp, conditionHostedZoneDiscovered, reasonFound).WithMessage("Z123").TargetCompositeAndClaim()
+	response.ConditionFalse(rsp, conditionKeysGenerated, reasonGenerationFailed)
+
+	(&plan{}).quiet(rsp)
+
+	if len(rsp.GetConditions()) != 0 {
+		t.Errorf("quiet() kept conditions %v", rsp.GetConditions())
+	}
+
+	want := []string{
+		"dry run: would set spec.a to 1",
+		"dry run: warning: context deadline exceeded",
+		"dry run: would set condition " + conditionHostedZoneDiscovered + " to True (" + reasonFound + "): Z123",
+		"dry run: would set condition " + conditionKeysGenerated + " to False (" + reasonGenerationFailed + ")",
+	}
+
+	var got []string
+	for _, r := range rsp.GetResults() {
+		if r.GetSeverity() != fnv1.Severity_SEVERITY_NORMAL {
+			t.Errorf("quiet() result %q has severity %s", r.GetMessage(), r.GetSeverity())
+		}
+		if r.GetTarget() == fnv1.Target_TARGET_COMPOSITE_AND_CLAIM {
+			t.Errorf("quiet() result %q targets the claim", r.GetMessage())
+		}
+		got = append(got, r.GetMessage())
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("quiet() -want, +got:\n%s", diff)
+	}
+}
+
+func TestDryRunThumbprint(t *testing.T) {
+	withDialTLS(t, func(context.Context, string) (*tls.ConnectionState, error) {
+		t.Error("dialTLS() called in a dry run")
+		return nil, context.Canceled
+	})
+
+	cases := map[string]struct {
+		source   v1beta1.ThumbprintSource
+		recorded []any
+		want     string
+	}{
+		"AutoKeepsRecorded": {source: v1beta1.ThumbprintSourceAuto, recorded: []any{"0123456789abcdef"}, want: "0123456789abcdef"},
+		"TLSKeepsRecorded":  {source: v1beta1.ThumbprintSourceTLS, recorded: []any{"0123456789abcdef"}, want: "0123456789abcdef"},
+		"AutoOffline":       {source: v1beta1.ThumbprintSourceAuto, want: s3Thumbprint},
+		"TLSOffline":        {source: v1beta1.ThumbprintSourceTLS, want: s3Thumbprint},
+		"Offline":           {source: v1beta1.ThumbprintSourceOffline, recorded: []any{"0123456789abcdef"}, want: s3Thumbprint},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			status := map[string]any{}
+			if tc.recorded != nil {
+				status["issuerThumbprints"] = tc.recorded
+			}
+			oxr, c := newTestComposition(map[string]any{"status": status})
+			spec := &v1beta1.Thumbprint{Source: tc.source, PatchToRef: "status.issuerThumbprints"}
+
+			got, err := newTestFunction().DryRunThumbprint(context.Background(), "https://s3.eu-west-1.amazonaws.com/bucket", v1beta1.IssuerModeS3PathStyle, PartitionForRegion("eu-west-1"), spec, oxr, c)
+			if err != nil {
+				t.Fatalf("DryRunThumbprint() error = %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("DryRunThumbprint() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,406 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+	"github.com/crossplane/crossplane-runtime/pkg/fieldpath"
+	"github.com/crossplane/function-sdk-go/resource"
+	"github.com/crossplane/function-sdk-go/resource/composed"
+	"github.com/giantswarm/xfnlib/pkg/composite"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/giantswarm/crossplane-fn-irsa/pkg/input/v1beta1"
+)
+
+const (
+	// externalNameAnnotation makes the provider import an existing resource
+	externalNameAnnotation = "crossplane.io/external-name"
+
+	// clusterTag is applied when the XR does not define any tags
+	clusterTag = "giantswarm.io/cluster"
+
+	// certificateRegion is the only region CloudFront accepts certificates from
+	certificateRegion = "us-east-1"
+
+	recordTTL = int64(300)
+)
+
+// RenderParams holds everything the IRSA managed resources are rendered from.
+type RenderParams struct {
+	// Name is the prefix of the resource names, usually the XR name
+	Name      string
+	Mode      v1beta1.IssuerMode
+	Partition Partition
+	Region    string
+
+	BucketName string
+	Domain     string
+	Issuer     string
+
+	ProviderConfig           string
+	DNSProviderConfig        string
+	CloudFrontProviderConfig string
+	IAMProviderConfig        string
+
+	Tags map[string]string
+
+	// Thumbprint of the issuer root CA, the known thumbprint of the endpoint
+	// is used when empty
+	Thumbprint string
+
+	// Import IDs of existing resources, empty when nothing was discovered
+	HostedZoneID      string
+	DistributionID    string
+	OpenIdProviderArn string
+}
+
+// RenderResources adds the IRSA managed resources to the desired composed
+// resources. It renders the same resources, under the same names, as the KCL
+// step of the bundled composition so that either can take over from the
+// other.
+//
+// Resources depending on values only known once another resource has been
+// created, such as the certificate validation record, are added as soon as
+// those values are observed. Once observed themselves they are always
+// rendered, keeping their previous values while the status they depend on is
+// unavailable, so that they are never deleted by omission.
+func (f *Function) RenderResources(p RenderParams, composed *composite.Composition) (err error) {
+	resources := []*unstructured.Unstructured{
+		oidcProvider(p),
+		bucket(p),
+	}
+
+	switch p.Mode {
+	case v1beta1.IssuerModeCloudFront:
+		resources = append(resources, cloudFrontResources(p, composed)...)
+	case v1beta1.IssuerModeS3PathStyle, v1beta1.IssuerModeS3VirtualHost:
+		resources = append(resources, publicBucketResources(p, composed)...)
+	}
+
+	for _, u := range resources {
+		if err = addDesiredResource(composed, u); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func oidcProvider(p RenderParams) *unstructured.Unstructured {
+	forProvider := map[string]any{
+		"url":          p.Issuer,
+		"clientIdList": []any{"sts." + p.Partition.DNSSuffix},
+		"tags":         tagsOf(p.Tags),
+	}
+
+	thumbprint := p.Thumbprint
+	if thumbprint == "" {
+		thumbprint, _ = KnownThumbprint(p.Mode, p.Partition)
+	}
+	if thumbprint != "" {
+		forProvider["thumbprintList"] = []any{thumbprint}
+	}
+
+	u := managedResource("iam.aws.upbound.io/v1beta1", "OpenIDConnectProvider", p.Name+"-oidc", p.IAMProviderConfig, forProvider)
+	setExternalName(u, p.OpenIdProviderArn)
+
+	return u
+}
+
+func bucket(p RenderParams) *unstructured.Unstructured {
+	return managedResource("s3.aws.upbound.io/v1beta1", "Bucket", p.BucketName, p.ProviderConfig, map[string]any{
+		"region": p.Region,
+		"tags":   tagsOf(p.Tags),
+	})
+}
+
+// cloudFrontResources renders the resources serving the issuer through
+// CloudFront on irsa.<domain>
+func cloudFrontResources(p RenderParams, composed *composite.Composition) []*unstructured.Unstructured {
+	var (
+		oaiName          = p.Name + "-irsa-s3-origin-access-identity"
+		certificateName  = p.Name + "-irsa-cloudfront-certificate"
+		distributionName = p.Name + "-irsa-cloudfront-distribution"
+		irsaDomain       = "irsa." + p.Domain
+	)
+
+	resources := []*unstructured.Unstructured{
+		managedResource("cloudfront.aws.upbound.io/v1beta1", "OriginAccessIdentity", oaiName, p.CloudFrontProviderConfig, map[string]any{
+			"comment": fmt.Sprintf("%s OAI for IRSA S3 bucket", p.Name),
+			"region":  p.Region,
+		}),
+		managedResource("acm.aws.upbound.io/v1beta1", "Certificate", certificateName, p.CloudFrontProviderConfig, map[string]any{
+			"validationMethod": "DNS",
+			"region":           certificateRegion,
+			"domainName":       irsaDomain,
+			"tags":             tagsOf(p.Tags),
+		}),
+	}
+
+	var (
+		validationName = p.Name + "-validation"
+		cnameName      = p.Name + "-irsa-cname"
+	)
+
+	recordName := observedOr(composed, certificateName, "status.atProvider.domainValidationOptions[0].resourceRecordName", validationName, "spec.forProvider.name")
+	recordValue := observedOr(composed, certificateName, "status.atProvider.domainValidationOptions[0].resourceRecordValue", validationName, "spec.forProvider.records[0]")
+	recordType := observedOr(composed, certificateName, "status.atProvider.domainValidationOptions[0].resourceRecordType", validationName, "spec.forProvider.type")
+	if recordName != "" && recordValue != "" {
+		resources = append(resources, managedResource("route53.aws.upbound.io/v1beta1", "Record", validationName, p.DNSProviderConfig, map[string]any{
+			"allowOverwrite": true,
+			"ttl":            recordTTL,
+			"name":           recordName,
+			"records":        []any{recordValue},
+			"type":           recordType,
+			"zoneId":         p.HostedZoneID,
+			"region":         p.Region,
+		}))
+	}
+
+	oaiPath := observedOr(composed, oaiName, "status.atProvider.cloudfrontAccessIdentityPath", distributionName, "spec.forProvider.origin[0].s3OriginConfig.originAccessIdentity")
+	certificateArn := observedOr(composed, certificateName, "status.atProvider.arn", distributionName, "spec.forProvider.viewerCertificate.acmCertificateArn")
+	if oaiPath != "" && certificateArn != "" {
+		distribution := managedResource("cloudfront.aws.upbound.io/v1beta2", "Distribution", distributionName, p.CloudFrontProviderConfig, map[string]any{
+			"enabled":           true,
+			"defaultRootObject": "index.html",
+			"region":            p.Region,
+			"origin": []any{
+				map[string]any{
+					"domainName": p.BucketName + "." + p.Partition.S3Endpoint(p.Region),
+					"originId":   p.BucketName,
+					"s3OriginConfig": map[string]any{
+						"originAccessIdentity": oaiPath,
+					},
+				},
+			},
+			"aliases": []any{irsaDomain},
+			"restrictions": map[string]any{
+				"geoRestriction": map[string]any{
+					"restrictionType": "none",
+				},
+			},
+			"defaultCacheBehavior": map[string]any{
+				"allowedMethods":       []any{"GET", "HEAD"},
+				"cachedMethods":        []any{"GET", "HEAD"},
+				"viewerProtocolPolicy": "redirect-to-https",
+				"forwardedValues": map[string]any{
+					"cookies": map[string]any{"forward": "none"},
+				},
+				"targetOriginId": p.BucketName,
+			},
+			"viewerCertificate": map[string]any{
+				"acmCertificateArn":      certificateArn,
+				"sslSupportMethod":       "sni-only",
+				"minimumProtocolVersion": "TLSv1.2_2021",
+			},
+		})
+		setExternalName(distribution, p.DistributionID)
+		resources = append(resources, distribution)
+	}
+
+	if cloudFrontDomain := observedOr(composed, distributionName, "status.atProvider.domainName", cnameName, "spec.forProvider.records[0]"); cloudFrontDomain != "" {
+		resources = append(resources, managedResource("route53.aws.upbound.io/v1beta1", "Record", cnameName, p.DNSProviderConfig, map[string]any{
+			"allowOverwrite": true,
+			"type":           "CNAME",
+			"ttl":            recordTTL,
+			"name":           irsaDomain,
+			"records":        []any{cloudFrontDomain},
+			"zoneId":         p.HostedZoneID,
+			"region":         p.Region,
+		}))
+	}
+
+	oaiArn := observedString(composed, oaiName, "status.atProvider.iamArn")
+	bucketArn := observedString(composed, p.BucketName, "status.atProvider.arn")
+	if oaiArn != "" && bucketArn != "" {
+		resources = append(resources, bucketPolicy(p, map[string]any{
+			"Version": "2012-10-17",
+			"Id":      "PolicyForCloudFrontPrivateContent",
+			"Statement": []any{
+				map[string]any{
+					"Effect":    "Allow",
+					"Principal": map[string]any{"AWS": oaiArn},
+					"Action":    "s3:GetObject",
+					"Resource":  bucketArn + "/*",
+				},
+			},
+		}))
+	} else if u := observedPolicy(p, composed); u != nil {
+		resources = append(resources, u)
+	}
+
+	return resources
+}
+
+// publicBucketResources renders the resources making the bucket readable
+// through the public S3 endpoint
+func publicBucketResources(p RenderParams, composed *composite.Composition) []*unstructured.Unstructured {
+	resources := []*unstructured.Unstructured{
+		managedResource("s3.aws.upbound.io/v1beta1", "BucketPublicAccessBlock", p.Name+"-public-access-block", p.ProviderConfig, map[string]any{
+			"bucketRef":             map[string]any{"name": p.BucketName},
+			"region":                p.Region,
+			"blockPublicAcls":       false,
+			"blockPublicPolicy":     false,
+			"ignorePublicAcls":      false,
+			"restrictPublicBuckets": false,
+		}),
+		managedResource("s3.aws.upbound.io/v1beta1", "BucketOwnershipControls", p.Name+"-ownership", p.ProviderConfig, map[string]any{
+			"bucketRef": map[string]any{"name": p.BucketName},
+			"region":    p.Region,
+			"rule": []any{
+				map[string]any{"objectOwnership": "ObjectWriter"},
+			},
+		}),
+	}
+
+	if bucketArn := observedString(composed, p.BucketName, "status.atProvider.arn"); bucketArn != "" {
+		resources = append(resources, bucketPolicy(p, map[string]any{
+			"Version": "2012-10-17",
+			"Statement": []any{
+				map[string]any{
+					"Effect":    "Allow",
+					"Principal": "*",
+					"Action":    []any{"s3:GetObject"},
+					"Resource":  bucketArn + "/*",
+				},
+			},
+		}))
+	} else if u := observedPolicy(p, composed); u != nil {
+		resources = append(resources, u)
+	}
+
+	return resources
+}
+
+func bucketPolicy(p RenderParams, policy map[string]any) *unstructured.Unstructured {
+	b, _ := json.Marshal(policy)
+	return bucketPolicyDocument(p, string(b))
+}
+
+// observedPolicy renders the bucket policy with the document it was last
+// observed with, or returns nil if it has not been created yet
+func observedPolicy(p RenderParams, composed *composite.Composition) *unstructured.Unstructured {
+	policy := observedString(composed, p.Name+"-policy", "spec.forProvider.policy")
+	if policy == "" {
+		return nil
+	}
+	return bucketPolicyDocument(p, policy)
+}
+
+func bucketPolicyDocument(p RenderParams, policy string) *unstructured.Unstructured {
+	return managedResource("s3.aws.upbound.io/v1beta1", "BucketPolicy", p.Name+"-policy", p.ProviderConfig, map[string]any{
+		"bucketRef": map[string]any{"name": p.BucketName},
+		"region":    p.Region,
+		"policy":    policy,
+	})
+}
+
+// managedResource returns a managed resource of the AWS provider
+func managedResource(apiVersion, kind, name, providerConfig string, forProvider map[string]any) *unstructured.Unstructured {
+	return &unstructured.Unstructured{
+		Object: map[string]any{
+			"apiVersion": apiVersion,
+			"kind":       kind,
+			"metadata": map[string]any{
+				"name": name,
+			},
+			"spec": map[string]any{
+				"providerConfigRef": map[string]any{
+					"name": providerConfig,
+				},
+				"forProvider": forProvider,
+			},
+		},
+	}
+}
+
+// setExternalName imports an existing resource if an ID was discovered
+func setExternalName(u *unstructured.Unstructured, id string) {
+	if id == "" {
+		return
+	}
+	u.SetAnnotations(map[string]string{externalNameAnnotation: id})
+}
+
+func tagsOf(tags map[string]string) map[string]any {
+	m := make(map[string]any, len(tags))
+	for k, v := range tags {
+		m[k] = v
+	}
+	return m
+}
+
+// observedString returns a string field of an observed composed resource, or
+// an empty string if the resource or field does not exist (yet).
+func observedString(composed *composite.Composition, name, path string) string {
+	o, ok := composed.ObservedComposed[resource.Name(name)]
+	if !ok || o.Resource == nil {
+		return ""
+	}
+
+	value, _ := fieldpath.Pave(o.Resource.Object).GetString(path)
+	return value
+}
+
+// observedOr returns a string field of an observed composed resource, falling
+// back to the value last rendered into the resource depending on it while the
+// field is empty
+func observedOr(composed *composite.Composition, name, path, dependent, dependentPath string) string {
+	if value := observedString(composed, name, path); value != "" {
+		return value
+	}
+	return observedString(composed, dependent, dependentPath)
+}
+
+// addDesiredResource adds a resource to the desired composed resources under
+// its metadata name. Unlike composite.AddDesired readiness is left for the
+// auto-ready step to determine from the observed resource.
+func addDesiredResource(c *composite.Composition, u *unstructured.Unstructured) error {
+	name := u.GetName()
+	if name == "" {
+		return errors.Errorf("cannot add %s without a name", u.GetKind())
+	}
+
+	c.DesiredComposed[resource.Name(name)] = &resource.DesiredComposed{
+		Resource: &composed.Unstructured{Unstructured: *u},
+	}
+	return nil
+}
+
+// resourceTags returns the tags to apply to the managed resources. Without
+// tags on the XR the resources are tagged with the cluster name.
+func (f *Function) resourceTags(spec *v1beta1.Rendering, oxr *resource.Composite) (tags map[string]string, err error) {
+	var paved *fieldpath.Paved
+	if paved, err = fieldpath.PaveObject(oxr.Resource); err != nil {
+		return
+	}
+
+	if spec.TagsRef != "" {
+		if err = paved.GetValueInto(spec.TagsRef, &tags); err != nil && !fieldpath.IsNotFound(err) {
+			return nil, errors.Wrapf(err, "cannot get tags from %q", spec.TagsRef)
+		}
+	}
+
+	if len(tags) == 0 && spec.ClusterNameRef != "" {
+		var name string
+		if name, err = paved.GetString(spec.ClusterNameRef); err != nil && !fieldpath.IsNotFound(err) {
+			return nil, errors.Wrapf(err, "cannot get cluster name from %q", spec.ClusterNameRef)
+		}
+		tags = map[string]string{clusterTag: name}
+	}
+
+	return tags, nil
+}
+
+// desiredString returns a value patched to the desired XR earlier in the run,
+// such as a discovered import ID.
+func (f *Function) desiredString(ref string, composed *composite.Composition) string {
+	if ref == "" {
+		return ""
+	}
+
+	value, _ := f.getStringFromPaved(composed.DesiredComposite.Resource, ref)
+	return value
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/crossplane/crossplane-runtime/pkg/fieldpath"
+	"github.com/crossplane/function-sdk-go/resource"
+	"github.com/crossplane/function-sdk-go/resource/composed"
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/giantswarm/crossplane-fn-irsa/pkg/input/v1beta1"
+)
+
+func testRenderParams(mode v1beta1.IssuerMode) RenderParams {
+	return RenderParams{
+		Name:                     "test",
+		Mode:                     mode,
+		Partition:                PartitionForRegion("eu-west-1"),
+		Region:                   "eu-west-1",
+		BucketName:               "test-irsa",
+		Domain:                   "test.example.com",
+		Issuer:                   "https://irsa.test.example.com",
+		ProviderConfig:           "default",
+		DNSProviderConfig:        "dns",
+		CloudFrontProviderConfig: "cloudfront",
+		IAMProviderConfig:        "iam",
+		HostedZoneID:             "Z123",
+	}
+}
+
+// withStatus returns the status.atProvider of observed composed resources
+func withStatus(atProvider map[string]map[string]any) map[resource.Name]resource.ObservedComposed {
+	observed := make(map[resource.Name]resource.ObservedComposed, len(atProvider))
+	for name, status := range atProvider {
+		observed[resource.Name(name)] = resource.ObservedComposed{Resource: &composed.Unstructured{Unstructured: unstructured.Unstructured{
+			Object: map[string]any{"status": map[string]any{"atProvider": status}},
+		}}}
+	}
+	return observed
+}
+
+// observeDesired returns the desired composed resources as observed, without
+// any status
+func observeDesired(desired map[resource.Name]*resource.DesiredComposed) map[resource.Name]resource.ObservedComposed {
+	observed := make(map[resource.Name]resource.ObservedComposed, len(desired))
+	for name, d := range desired {
+		observed[name] = resource.ObservedComposed{Resource: d.Resource.DeepCopy()}
+	}
+	return observed
+}
+
+func desiredNames(desired map[resource.Name]*resource.DesiredComposed) []string {
+	names := make([]string, 0, len(desired))
+	for name := range desired {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// cloudFrontStatus returns the status of the CloudFront stack once every
+// resource is ready
+func cloudFrontStatus() map[string]map[string]any {
+	return map[string]map[string]any{
+		"test-irsa-s3-origin-access-identity": {
+			"cloudfrontAccessIdentityPath": "origin-access-identity/cloudfront/E123",
+			"iamArn":                       "arn:aws:iam::cloudfront:user/CloudFront Origin Access Identity E123",
+		},
+		"test-irsa-cloudfront-certificate": {
+			"arn": "arn:aws:acm:us-east-1:123456789012:certificate/abc",
+			"domainValidationOptions": []any{map[string]any{
+				"resourceRecordName":  "_x.irsa.test.example.com.",
+				"resourceRecordValue": "_y.acm-validations.aws.",
+				"resourceRecordType":  "CNAME",
+			}},
+		},
+		"test-irsa-cloudfront-distribution": {"domainName": "d123.cloudfront.net"},
+		"test-irsa":                         {"arn": "arn:aws:s3:::test-irsa"},
+	}
+}
+
+func TestRenderResources(t *testing.T) {
+	cases := map[string]struct {
+		mode     v1beta1.IssuerMode
+		observed map[resource.Name]resource.ObservedComposed
+		want     []string
+	}{
+		"CloudFrontNothingObserved": {
+			mode: v1beta1.IssuerModeCloudFront,
+			want: []string{
+				"test-irsa",
+				"test-irsa-cloudfront-certificate",
+				"test-irsa-s3-origin-access-identity",
+				"test-oidc",
+			},
+		},
+		"CloudFrontStatusObserved": {
+			mode:     v1beta1.IssuerModeCloudFront,
+			observed: withStatus(cloudFrontStatus()),
+			want: []string{
+				"test-irsa",
+				"test-irsa-cloudfront-certificate",
+				"test-irsa-cloudfront-distribution",
+				"test-irsa-cname",
+				"test-irsa-s3-origin-access-identity",
+				"test-oidc",
+				"test-policy",
+				"test-validation",
+			},
+		},
+		"S3NothingObserved": {
+			mode: v1beta1.IssuerModeS3PathStyle,
+			want: []string{"test-irsa", "test-oidc", "test-ownership", "test-public-access-block"},
+		},
+		"S3StatusObserved": {
+			mode:     v1beta1.IssuerModeS3VirtualHost,
+			observed: withStatus(map[string]map[string]any{"test-irsa": {"arn": "arn:aws:s3:::test-irsa"}}),
+			want:     []string{"test-irsa", "test-oidc", "test-ownership", "test-policy", "test-public-access-block"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, c := newTestComposition(nil)
+			if tc.observed != nil {
+				c.ObservedComposed = tc.observed
+			}
+
+			if err := newTestFunction().RenderResources(testRenderParams(tc.mode), c); err != nil {
+				t.Fatalf("RenderResources() error = %v", err)
+			}
+			if diff := cmp.Diff(tc.want, desiredNames(c.DesiredComposed)); diff != "" {
+				t.Errorf("RenderResources() -want, +got:\n%s", diff)
+			}
+		})
+	}
+}
+
+// TestRenderResourcesKeepsObserved ensures resources that exist are rendered
+// unchanged while the status they were rendered from is unavailable, as
+// omitting them from the desired state would delete them.
+func TestRenderResourcesKeepsObserved(t *testing.T) {
+	cases := map[string]struct {
+		mode   v1beta1.IssuerMode
+		status map[string]map[string]any
+	}{
+		"CloudFront": {
+			mode:   v1beta1.IssuerModeCloudFront,
+			status: cloudFrontStatus(),
+		},
+		"S3": {
+			mode:   v1beta1.IssuerModeS3PathStyle,
+			status: map[string]map[string]any{"test-irsa": {"arn": "arn:aws:s3:::test-irsa"}},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			f, p := newTestFunction(), testRenderParams(tc.mode)
+
+			_, first := newTestComposition(nil)
+			first.ObservedComposed = withStatus(tc.status)
+			if err := f.RenderResources(p, first); err != nil {
+				t.Fatalf("RenderResources() error = %v", err)
+			}
+
+			// Every resource exists, but none reports a status
+			_, second := newTestComposition(nil)
+			second.ObservedComposed = observeDesired(first.DesiredComposed)
+			if err := f.RenderResources(p, second); err != nil {
+				t.Fatalf("RenderResources() error = %v", err)
+			}
+
+			if diff := cmp.Diff(desiredNames(first.DesiredComposed), desiredNames(second.DesiredComposed)); diff != "" {
+				t.Fatalf("RenderResources() dropped observed resources -want, +got:\n%s", diff)
+			}
+			for name, want := range first.DesiredComposed {
+				if diff := cmp.Diff(want.Resource.Object, second.DesiredComposed[name].Resource.Object); diff != "" {
+					t.Errorf("RenderResources() changed %s -want, +got:\n%s", name, diff)
+				}
+			}
+		})
+	}
+}
+
+func TestRenderResourcesProviderConfigs(t *testing.T) {
+	want := map[string]string{
+		"test-irsa":                           "default",
+		"test-irsa-cloudfront-certificate":    "cloudfront",
+		"test-irsa-cloudfront-distribution":   "cloudfront",
+		"test-irsa-cname":                     "dns",
+		"test-irsa-s3-origin-access-identity": "cloudfront",
+		"test-oidc":                           "iam",
+		"test-policy":                         "default",
+		"test-validation":                     "dns",
+	}
+
+	_, c := newTestComposition(nil)
+	c.ObservedComposed = withStatus(cloudFrontStatus())
+
+	if err := newTestFunction().RenderResources(testRenderParams(v1beta1.IssuerModeCloudFront), c); err != nil {
+		t.Fatalf("RenderResources() error = %v", err)
+	}
+
+	got := make(map[string]string, len(c.DesiredComposed))
+	for name, dc := range c.DesiredComposed {
+		got[string(name)], _ = fieldpath.Pave(dc.Resource.Object).GetString("spec.providerConfigRef.name")
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("RenderResources() providerConfigRef -want, +got:\n%s", diff)
+	}
+}
+
+func TestManagedResource(t *testing.T) {
+	forProvider := map[string]any{
+		"url":            "https://irsa.test.example.com",
+		"clientIdList":   []any{"sts.amazonaws.com"},
+		"thumbprintList": []any{"06b25927c42a721631c1efd9431e648fa62e1e39"},
+	}
+
+	cases := map[string]struct {
+		id   string
+		want map[string]any
+	}{
+		"New": {
+			want: map[string]any{
+				"apiVersion": "iam.aws.upbound.io/v1beta1",
+				"kind":       "OpenIDConnectProvider",
+				"metadata": map[string]any{
+					"name": "test-oidc",
+				},
+				"spec": map[string]any{
+					"providerConfigRef": map[string]any{"name": "iam"},
+					"forProvider":       forProvider,
+				},
+			},
+		},
+		"Imported": {
+			id: "arn:aws:iam::123456789012:oidc-provider/irsa.test.example.com",
+			want: map[string]any{
+				"apiVersion": "iam.aws.upbound.io/v1beta1",
+				"kind":       "OpenIDConnectProvider",
+				"metadata": map[string]any{
+					"name": "test-oidc",
+					"annotations": map[string]any{
+						"crossplane.io/external-name": "arn:aws:iam::123456789012:oidc-provider/irsa.test.example.com",
+					},
+				},
+				"spec": map[string]any{
+					"providerConfigRef": map[string]any{"name": "iam"},
+					"forProvider":       forProvider,
+				},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			u := managedResource("iam.aws.upbound.io/v1beta1", "OpenIDConnectProvider", "test-oidc", "iam", forProvider)
+			setExternalName(u, tc.id)
+
+			if diff := cmp.Diff(tc.want, u.Object); diff != "" {
+				t.Errorf("managedResource() -want +got:\n%s", diff)
+			}
+		})
+	}
+}
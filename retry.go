@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/aws/ratelimit"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/smithy-go/middleware"
+	"golang.org/x/time/rate"
+)
+
+// RetryOptions configure the retryer shared by all AWS clients
+type RetryOptions struct {
+	MaxAttempts int
+	MaxBackoff  time.Duration
+
+	// Adaptive additionally delays requests on the client side while a
+	// service is throttling
+	Adaptive bool
+}
+
+// RateLimitOptions configure the client side rate limit of AWS API calls per
+// account and service. A rate of zero disables the limit.
+type RateLimitOptions struct {
+	Rate  float64
+	Burst int
+}
+
+var (
+	awsRetryOptions = RetryOptions{
+		MaxAttempts: retry.DefaultMaxAttempts,
+		MaxBackoff:  retry.DefaultMaxBackoff,
+	}
+
+	awsRateLimitOptions = RateLimitOptions{}
+
+	retryers = struct {
+		sync.Mutex
+		byKey map[string]aws.Retryer
+	}{byKey: make(map[string]aws.Retryer)}
+
+	rateLimiters = struct {
+		sync.Mutex
+		byKey map[string]*rate.Limiter
+	}{byKey: make(map[string]*rate.Limiter)}
+
+	// callerAccounts holds the account of each ProviderConfig once looked up
+	callerAccounts = struct {
+		sync.Mutex
+		byProviderConfig map[string]string
+	}{byProviderConfig: make(map[string]string)}
+)
+
+// accountKey is the stack value holding the account of a call
+type accountKey struct{}
+
+// limitKey returns the account and service of a call, which rate limiters and
+// retryers are shared by
+func limitKey(ctx context.Context) string {
+	account, _ := middleware.GetStackValue(ctx, accountKey{}).(string)
+	return account + "/" + awsmiddleware.GetServiceID(ctx)
+}
+
+// accountRetryer retries every call with the retryer shared by the account
+// and service of the call. Only attempt and retry tokens hold state; the
+// other methods only depend on the retry options.
+type accountRetryer struct{}
+
+var _ aws.RetryerV2 = accountRetryer{}
+
+func (accountRetryer) IsErrorRetryable(err error) bool {
+	return sharedRetryer("").IsErrorRetryable(err)
+}
+
+func (accountRetryer) MaxAttempts() int {
+	return sharedRetryer("").MaxAttempts()
+}
+
+func (accountRetryer) RetryDelay(attempt int, opErr error) (time.Duration, error) {
+	return sharedRetryer("").RetryDelay(attempt, opErr)
+}
+
+func (accountRetryer) GetRetryToken(ctx context.Context, opErr error) (func(error) error, error) {
+	return sharedRetryer(limitKey(ctx)).GetRetryToken(ctx, opErr)
+}
+
+func (accountRetryer) GetInitialToken() func(error) error {
+	return sharedRetryer("").GetInitialToken()
+}
+
+func (accountRetryer) GetAttemptToken(ctx context.Context) (func(error) error, error) {
+	return sharedRetryer(limitKey(ctx)).(aws.RetryerV2).GetAttemptToken(ctx)
+}
+
+// sharedRetryer returns the retryer used by all calls with the same key, so
+// that adaptive mode sees the throttling of every call to a service in an
+// account.
+func sharedRetryer(key string) aws.Retryer {
+	retryers.Lock()
+	defer retryers.Unlock()
+
+	if r, ok := retryers.byKey[key]; ok {
+		return r
+	}
+
+	standard := func(o *retry.StandardOptions) {
+		o.MaxAttempts = awsRetryOptions.MaxAttempts
+		o.MaxBackoff = awsRetryOptions.MaxBackoff
+
+		// The retry quota of the SDK is meant for a single client and would
+		// stop all retries of the process once exhausted
+		o.RateLimiter = ratelimit.None
+	}
+
+	var r aws.Retryer = retry.NewStandard(standard)
+	if awsRetryOptions.Adaptive {
+		r = retry.NewAdaptiveMode(func(o *retry.AdaptiveModeOptions) {
+			o.StandardOptions = append(o.StandardOptions, standard)
+		})
+	}
+
+	retryers.byKey[key] = r
+	return r
+}
+
+// rateLimiter returns the limiter shared by all calls with the same key
+func rateLimiter(key string) *rate.Limiter {
+	rateLimiters.Lock()
+	defer rateLimiters.Unlock()
+
+	if l, ok := rateLimiters.byKey[key]; ok {
+		return l
+	}
+
+	burst := awsRateLimitOptions.Burst
+	if burst < 1 {
+		burst = 1
+	}
+
+	l := rate.NewLimiter(rate.Limit(awsRateLimitOptions.Rate), burst)
+	rateLimiters.byKey[key] = l
+	return l
+}
+
+// withAccountLimits shares the rate limit and the adaptive retryer of the AWS
+// API calls made with the config per account and service. The account is
+// looked up on the first call and reused for the lifetime of the process,
+// falling back to the ProviderConfig if the caller identity cannot be
+// retrieved.
+func (f *Function) withAccountLimits(cfg aws.Config, services map[string]string, providerConfigRef string) aws.Config {
+	if awsRateLimitOptions.Rate <= 0 && !awsRetryOptions.Adaptive {
+		return cfg
+	}
+
+	// The identity is looked up without the limit, which depends on it
+	client := getStsClient(cfg, services["sts"])
+
+	var (
+		mu       sync.Mutex
+		resolved string
+	)
+	account := func(ctx context.Context) string {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if resolved != "" {
+			return resolved
+		}
+
+		account, ok := f.callerAccount(ctx, client, providerConfigRef)
+		if ok || ctx.Err() == nil {
+			resolved = account
+		}
+		return account
+	}
+
+	return withAPIOptions(cfg, func(stack *middleware.Stack) error {
+		if err := addAccountMiddleware(stack, account); err != nil {
+			return err
+		}
+		if awsRateLimitOptions.Rate <= 0 {
+			return nil
+		}
+		return addRateLimitMiddleware(stack)
+	})
+}
+
+// callerAccount returns the account of the ProviderConfig, or a key derived
+// from the ProviderConfig and false if the caller identity cannot be retrieved
+func (f *Function) callerAccount(ctx context.Context, client AwsStsApi, providerConfigRef string) (string, bool) {
+	callerAccounts.Lock()
+	account, ok := callerAccounts.byProviderConfig[providerConfigRef]
+	callerAccounts.Unlock()
+	if ok {
+		return account, true
+	}
+
+	identity, err := GetCallerIdentity(ctx, client, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		f.log.Debug("cannot get caller identity, rate limiting by ProviderConfig", "providerConfig", providerConfigRef, "error", err)
+		return "providerconfig/" + providerConfigRef, false
+	}
+
+	account = aws.ToString(identity.Account)
+	callerAccounts.Lock()
+	callerAccounts.byProviderConfig[providerConfigRef] = account
+	callerAccounts.Unlock()
+
+	return account, true
+}
+
+// addAccountMiddleware records the account of a call for the rate limit and
+// retry middlewares
+func addAccountMiddleware(stack *middleware.Stack, account func(context.Context) string) error {
+	return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("IRSAAccount", func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+		return next.HandleInitialize(middleware.WithStackValue(ctx, accountKey{}, account(ctx)), in)
+	}), middleware.After)
+}
+
+// addRateLimitMiddleware waits for the rate limiter of the account and service
+// before every attempt of a call
+func addRateLimitMiddleware(stack *middleware.Stack) error {
+	return stack.Finalize.Insert(middleware.FinalizeMiddlewareFunc("IRSARateLimit", func(ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler) (out middleware.FinalizeOutput, md middleware.Metadata, err error) {
+		if err = rateLimiter(limitKey(ctx)).Wait(ctx); err != nil {
+			if ctx.Err() == nil {
+				// The wait would outlast the deadline of the call
+				err = fmt.Errorf("%w: %v", context.DeadlineExceeded, err)
+			}
+			return out, md, err
+		}
+		return next.HandleFinalize(ctx, in)
+	}), "Retry", middleware.After)
+}
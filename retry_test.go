@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+	"golang.org/x/time/rate"
+)
+
+type fakeSts struct {
+	account string
+	err     error
+	calls   int
+}
+
+func (c *fakeSts) GetCallerIdentity(context.Context, *sts.GetCallerIdentityInput, ...func(*sts.Options)) (*sts.GetCallerIdentityOutput, error) {
+	c.calls++
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &sts.GetCallerIdentityOutput{Account: aws.String(c.account)}, nil
+}
+
+// withLimitOptions sets the rate limit and retry options for the test,
+// starting from empty registries
+func withLimitOptions(t *testing.T, rateOpts RateLimitOptions, retryOpts RetryOptions) {
+	t.Helper()
+	origRate, origRetry := awsRateLimitOptions, awsRetryOptions
+	awsRateLimitOptions, awsRetryOptions = rateOpts, retryOpts
+	reset := func() {
+		rateLimiters.byKey = make(map[string]*rate.Limiter)
+		retryers.byKey = make(map[string]aws.Retryer)
+		callerAccounts.byProviderConfig = make(map[string]string)
+	}
+	reset()
+	t.Cleanup(func() {
+		awsRateLimitOptions, awsRetryOptions = origRate, origRetry
+		reset()
+	})
+}
+
+func withStsClient(t *testing.T, client AwsStsApi) {
+	t.Helper()
+	orig := getStsClient
+	getStsClient = func(aws.Config, string) AwsStsApi { return client }
+	t.Cleanup(func() { getStsClient = orig })
+}
+
+// invoke runs a call through the API options of the config, taking a single
+// attempt token from the retryer of the clients
+func invoke(t *testing.T, cfg aws.Config) {
+	t.Helper()
+
+	stack := middleware.NewStack("test", smithyhttp.NewStackRequest)
+	if err := stack.Finalize.Add(middleware.FinalizeMiddlewareFunc("Retry", func(ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler) (middleware.FinalizeOutput, middleware.Metadata, error) {
+		release, err := accountRetryer{}.GetAttemptToken(ctx)
+		if err != nil {
+			return middleware.FinalizeOutput{}, middleware.Metadata{}, err
+		}
+		out, md, err := next.HandleFinalize(ctx, in)
+		return out, md, release(err)
+	}), middleware.After); err != nil {
+		t.Fatal(err)
+	}
+	for _, fn := range cfg.APIOptions {
+		if err := fn(stack); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	handler := middleware.DecorateHandler(middleware.HandlerFunc(func(context.Context, any) (any, middleware.Metadata, error) {
+		return nil, middleware.Metadata{}, nil
+	}), stack)
+	if _, _, err := handler.Handle(context.Background(), struct{}{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWithAPIOptions(t *testing.T) {
+	noop := func(*middleware.Stack) error { return nil }
+
+	cfg := aws.Config{APIOptions: make([]func(*middleware.Stack) error, 1, 4)}
+	cfg.APIOptions[0] = noop
+
+	a := withAPIOptions(cfg, noop)
+	b := withAPIOptions(cfg, noop, noop)
+
+	if len(cfg.APIOptions) != 1 || len(a.APIOptions) != 2 || len(b.APIOptions) != 3 {
+		t.Fatalf("withAPIOptions() lengths = %d, %d, %d, want 1, 2, 3", len(cfg.APIOptions), len(a.APIOptions), len(b.APIOptions))
+	}
+	if &a.APIOptions[0] == &cfg.APIOptions[0] || &a.APIOptions[0] == &b.APIOptions[0] {
+		t.Error("withAPIOptions() shares the options of the config")
+	}
+}
+
+func TestWithAccountLimits(t *testing.T) {
+	withLimitOptions(t, RateLimitOptions{Rate: 1000, Burst: 10}, awsRetryOptions)
+	client := &fakeSts{account: "123456789012"}
+	withStsClient(t, client)
+
+	f := newTestFunction()
+
+	// Loading the config does not look up the account
+	cfg := f.withAccountLimits(aws.Config{}, map[string]string{}, "default")
+	if client.calls != 0 {
+		t.Fatalf("GetCallerIdentity() calls = %d before any call, want 0", client.calls)
+	}
+
+	invoke(t, cfg)
+	invoke(t, cfg)
+
+	// Neither do later loads of the config for the same ProviderConfig
+	invoke(t, f.withAccountLimits(aws.Config{}, map[string]string{}, "default"))
+
+	if client.calls != 1 {
+		t.Errorf("GetCallerIdentity() calls = %d, want 1", client.calls)
+	}
+	if _, ok := rateLimiters.byKey["123456789012/"]; !ok || len(rateLimiters.byKey) != 1 {
+		t.Errorf("rate limiters = %v, want one for account 123456789012", rateLimiters.byKey)
+	}
+	if _, ok := retryers.byKey["123456789012/"]; !ok {
+		t.Errorf("retryers = %v, want one for account 123456789012", retryers.byKey)
+	}
+}
+
+func TestWithAccountLimitsWithoutIdentity(t *testing.T) {
+	withLimitOptions(t, RateLimitOptions{Rate: 1000, Burst: 10}, awsRetryOptions)
+	client := &fakeSts{err: errors.New("unreachable")}
+	withStsClient(t, client)
+
+	f := newTestFunction()
+	cfg := f.withAccountLimits(aws.Config{}, map[string]string{}, "default")
+
+	invoke(t, cfg)
+	invoke(t, cfg)
+	if client.calls != 1 {
+		t.Errorf("GetCallerIdentity() calls = %d, want 1 per config", client.calls)
+	}
+	if _, ok := rateLimiters.byKey["providerconfig/default/"]; !ok {
+		t.Errorf("rate limiters = %v, want one for ProviderConfig default", rateLimiters.byKey)
+	}
+
+	// The identity is looked up again once the config is reloaded
+	invoke(t, f.withAccountLimits(aws.Config{}, map[string]string{}, "default"))
+	if client.calls != 2 {
+		t.Errorf("GetCallerIdentity() calls = %d, want 2", client.calls)
+	}
+}
+
+func TestWithAccountLimitsAdaptive(t *testing.T) {
+	withLimitOptions(t, RateLimitOptions{}, RetryOptions{MaxAttempts: 3, MaxBackoff: time.Second, Adaptive: true})
+	withStsClient(t, &fakeSts{account: "123456789012"})
+
+	f := newTestFunction()
+	invoke(t, f.withAccountLimits(aws.Config{}, map[string]string{}, "default"))
+
+	withStsClient(t, &fakeSts{account: "210987654321"})
+	invoke(t, f.withAccountLimits(aws.Config{}, map[string]string{}, "other"))
+
+	// Without a rate limit, retryers are still shared per account and service
+	for _, key := range []string{"123456789012/", "210987654321/"} {
+		if _, ok := retryers.byKey[key].(*retry.AdaptiveMode); !ok {
+			t.Errorf("retryers = %v, want an adaptive retryer for %s", retryers.byKey, key)
+		}
+	}
+	if len(rateLimiters.byKey) != 0 {
+		t.Errorf("rate limiters = %v, want none", rateLimiters.byKey)
+	}
+}
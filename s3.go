@@ -4,20 +4,24 @@ import (
 	"bytes"
 	"context"
 	"crypto"
-	"crypto/rsa"
 	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
-	"encoding/pem"
 	"fmt"
 	"strings"
+	"text/template"
+
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
 
-	kclient "github.com/giantswarm/xfnlib/pkg/auth/kubernetes"
 	"github.com/giantswarm/xfnlib/pkg/composite"
 
 	"gopkg.in/square/go-jose.v2"
 	v1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/giantswarm/crossplane-fn-irsa/pkg/input/v1beta1"
 )
 
 type DiscoveryResponse struct {
@@ -30,53 +34,40 @@ type DiscoveryResponse struct {
 	ClaimsSupported                  []string `json:"claims_supported"`
 }
 
-func IsChina(region string) bool {
-	return strings.HasPrefix(region, "cn-")
-}
-
-func AWSEndpoint(region string) string {
-	awsEndpoint := "amazonaws.com"
-	if strings.HasPrefix(region, "cn-") {
-		awsEndpoint = "amazonaws.com.cn"
+// GenerateDiscoveryFile patches the OIDC discovery document for the issuer to
+// the desired XR and returns it.
+func (f *Function) GenerateDiscoveryFile(issuer string, algs []string, patchTo string, composed *composite.Composition) ([]byte, error) {
+	if len(algs) == 0 {
+		algs = []string{string(jose.RS256)}
 	}
-	return awsEndpoint
-}
 
-func (f *Function) GenerateDiscoveryFile(domain, bucketName, region string, patchTo string, composed *composite.Composition) error {
 	// see https://github.com/aws/amazon-eks-pod-identity-webhook/blob/master/SELF_HOSTED_SETUP.md#create-the-oidc-discovery-and-keys-documents
 	v := DiscoveryResponse{
 		AuthorizationEndpoint:            "urn:kubernetes:programmatic_authorization",
 		ResponseTypesSupported:           []string{"id_token"},
 		SubjectTypesSupported:            []string{"public"},
-		IDTokenSigningAlgValuesSupported: []string{"RS256"},
+		IDTokenSigningAlgValuesSupported: algs,
 		ClaimsSupported:                  []string{"sub", "iss"},
 	}
-	if !IsChina(region) {
-		// Cloudfront
-		v.Issuer = fmt.Sprintf("https://%s", domain)
-		v.JwksURI = fmt.Sprintf("https://%s/keys.json", domain)
-	} else {
-		// Public S3 endpoint
-		v.Issuer = fmt.Sprintf("https://s3.%s.%s/%s", region, AWSEndpoint(region), bucketName)
-		v.JwksURI = fmt.Sprintf("https://s3.%s.%s/%s/keys.json", region, AWSEndpoint(region), bucketName)
-	}
+	v.Issuer = issuer
+	v.JwksURI = JWKSURI(issuer)
 
 	b := &bytes.Buffer{}
 
 	if err := json.NewEncoder(b).Encode(&v); err != nil {
-		return fmt.Errorf("cannot encode to JSON: %w", err)
+		return nil, fmt.Errorf("cannot encode to JSON: %w", err)
 	}
 
 	err := f.patchFieldValueToObject(patchTo, b.Bytes(), composed.DesiredComposite.Resource)
-	return err
+	return b.Bytes(), err
 }
 
 type KeyResponse struct {
 	Keys []jose.JSONWebKey `json:"keys"`
 }
 
-func digestOfKey(key *rsa.PrivateKey) (string, error) {
-	publicKeyDERBytes, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+func digestOfKey(key crypto.PublicKey) (string, error) {
+	publicKeyDERBytes, err := x509.MarshalPKIXPublicKey(key)
 	if err != nil {
 		return "", fmt.Errorf("failed to serialize public key to DER format: %v", err)
 	}
@@ -90,48 +81,167 @@ func digestOfKey(key *rsa.PrivateKey) (string, error) {
 	return keyID, nil
 }
 
-func (f *Function) GenerateKeysFile(key *rsa.PrivateKey, patchTo string, composed *composite.Composition) error {
-	var alg jose.SignatureAlgorithm
-
-	kid, err := digestOfKey(key)
-	if err != nil {
-		return err
-	}
-
+// GenerateKeysFile publishes the given public keys as a JWKS. The first key
+// is expected to be the current signing key, any further keys are previous
+// keys still within their rotation overlap window. The JWKS is returned.
+func (f *Function) GenerateKeysFile(publicKeys []crypto.PublicKey, patchTo string, composed *composite.Composition) ([]byte, error) {
 	var keys []jose.JSONWebKey
-	keys = append(keys, jose.JSONWebKey{
-		Key:       key.Public(),
-		KeyID:     kid,
-		Algorithm: string(alg),
-		Use:       "sig",
-	})
+	for _, key := range publicKeys {
+		kid, err := digestOfKey(key)
+		if err != nil {
+			return nil, err
+		}
+
+		alg, err := signingAlgorithm(key)
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, jose.JSONWebKey{
+			Key:       key,
+			KeyID:     kid,
+			Algorithm: string(alg),
+			Use:       "sig",
+		})
+	}
 
 	keyResponse := KeyResponse{Keys: keys}
 	byt, err := json.MarshalIndent(keyResponse, "", "    ")
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	err = f.patchFieldValueToObject(patchTo, byt, composed.DesiredComposite.Resource)
-	return err
+	return byt, err
 }
 
-func (f *Function) ServiceAccountSecret(clusterNamespace, clusterName string) (*rsa.PrivateKey, error) {
+// defaultServiceAccountSecretNameTemplate names the secret cluster-api
+// creates for the service account signing key of a cluster.
+const defaultServiceAccountSecretNameTemplate = "{{ .ClaimName }}-sa"
+
+// ServiceAccountSecretRef identifies the secret and the data keys to read the
+// service account signing key from.
+type ServiceAccountSecretRef struct {
+	Namespace string
+	Name      string
+	Keys      []string
+}
+
+// serviceAccountSecretTemplateData is made available to the secret name
+// template.
+type serviceAccountSecretTemplateData struct {
+	Name           string
+	ClaimName      string
+	ClaimNamespace string
+	Labels         map[string]string
+	Spec           map[string]any
+}
+
+// ResolveServiceAccountSecret works out which secret holds the signing key for
+// the given XR, applying any overrides defined in the input.
+func (f *Function) ResolveServiceAccountSecret(xr *unstructured.Unstructured, spec *v1beta1.ServiceAccountSecret) (ref ServiceAccountSecretRef, err error) {
+	defer func() {
+		if err != nil {
+			err = &ServiceAccountKeyError{Reason: reasonSecretNotResolved, Err: err}
+		}
+	}()
+
+	if spec == nil {
+		spec = &v1beta1.ServiceAccountSecret{}
+	}
+
+	labels := xr.GetLabels()
+	ref = ServiceAccountSecretRef{
+		Namespace: labels["crossplane.io/claim-namespace"],
+		Keys:      serviceAccountKeyNames,
+	}
+
+	if spec.Key != "" {
+		ref.Keys = []string{spec.Key}
+	}
+
+	if spec.NamespaceRef != "" {
+		if ref.Namespace, err = f.getStringFromPaved(xr, spec.NamespaceRef); err != nil {
+			err = errors.Wrapf(err, "cannot get service account secret namespace from %q", spec.NamespaceRef)
+			return
+		}
+	}
+
+	if spec.NameRef != "" {
+		if ref.Name, err = f.getStringFromPaved(xr, spec.NameRef); err != nil {
+			err = errors.Wrapf(err, "cannot get service account secret name from %q", spec.NameRef)
+			return
+		}
+	} else {
+		nameTemplate := spec.NameTemplate
+		if nameTemplate == "" {
+			nameTemplate = defaultServiceAccountSecretNameTemplate
+		}
+
+		var tpl *template.Template
+		if tpl, err = template.New("name").Option("missingkey=error").Parse(nameTemplate); err != nil {
+			err = errors.Wrapf(err, "cannot parse service account secret name template %q", nameTemplate)
+			return
+		}
+
+		data := serviceAccountSecretTemplateData{
+			Name:           xr.GetName(),
+			ClaimName:      labels["crossplane.io/claim-name"],
+			ClaimNamespace: labels["crossplane.io/claim-namespace"],
+			Labels:         labels,
+		}
+		data.Spec, _, _ = unstructured.NestedMap(xr.Object, "spec")
+
+		b := &strings.Builder{}
+		if err = tpl.Execute(b, data); err != nil {
+			err = errors.Wrapf(err, "cannot render service account secret name template %q", nameTemplate)
+			return
+		}
+		ref.Name = b.String()
+	}
+
+	// An empty claim name renders the default template as "-sa"
+	if ref.Namespace == "" || ref.Name == "" || strings.HasPrefix(ref.Name, "-") {
+		err = errors.Errorf("cannot determine service account secret, got namespace %q and name %q", ref.Namespace, ref.Name)
+	}
+	return
+}
+
+// ServiceAccountSecret returns the public part of the cluster's service account
+// signing key. The secret may contain the private key or only the public key.
+func (f *Function) ServiceAccountSecret(ctx context.Context, ref ServiceAccountSecretRef) (crypto.PublicKey, error) {
 	oidcSecret := &v1.Secret{}
-	client, err := kclient.Client()
+	client, err := f.kubeClient()
 	if err != nil {
-		return nil, err
+		return nil, &ServiceAccountKeyError{Reason: reasonSecretUnavailable, Err: err}
 	}
-	f.log.Debug("getting service account secret", "clusterNamespace", clusterNamespace, "clusterName", clusterName)
-	err = client.Get(context.Background(), types.NamespacedName{Namespace: clusterNamespace, Name: clusterName + "-sa"}, oidcSecret)
+	f.log.Debug("getting service account secret", "namespace", ref.Namespace, "name", ref.Name)
+	err = client.Get(ctx, types.NamespacedName{Namespace: ref.Namespace, Name: ref.Name}, oidcSecret)
 	if err != nil {
-		return nil, err
+		reason := reasonSecretUnavailable
+		if kerrors.IsNotFound(err) {
+			reason = reasonSecretNotFound
+		}
+		return nil, &ServiceAccountKeyError{Reason: reason, Err: err}
 	}
-	privBytes := oidcSecret.Data["tls.key"]
-	block, _ := pem.Decode(privBytes)
-	privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
-	if err != nil {
-		return nil, err
+	for _, name := range ref.Keys {
+		data, ok := oidcSecret.Data[name]
+		if !ok {
+			continue
+		}
+
+		f.log.Debug("parsing service account key", "key", name)
+		key, err := parseSigningKey(data)
+		if err != nil {
+			return nil, &ServiceAccountKeyError{
+				Reason: reasonKeyParseError,
+				Err:    errors.Wrapf(err, "cannot parse %q of secret %s/%s", name, ref.Namespace, ref.Name),
+			}
+		}
+		return key, nil
+	}
+	return nil, &ServiceAccountKeyError{
+		Reason: reasonKeyNotFound,
+		Err:    fmt.Errorf("secret %s/%s does not contain any of %v", ref.Namespace, ref.Name, ref.Keys),
 	}
-	return privateKey, nil
 }
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/giantswarm/crossplane-fn-irsa/pkg/input/v1beta1"
+)
+
+func TestResolveServiceAccountSecret(t *testing.T) {
+	xr := func(labels map[string]any) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]any{
+			"metadata": map[string]any{
+				"name":   "test-x7k2p",
+				"labels": labels,
+			},
+			"spec": map[string]any{
+				"name":            "test",
+				"secretNamespace": "org-test-secrets",
+			},
+		}}
+	}
+	claimed := xr(map[string]any{
+		"crossplane.io/claim-name":      "test",
+		"crossplane.io/claim-namespace": "org-test",
+	})
+
+	cases := map[string]struct {
+		xr      *unstructured.Unstructured
+		spec    *v1beta1.ServiceAccountSecret
+		want    ServiceAccountSecretRef
+		wantErr bool
+	}{
+		"DefaultTemplate": {
+			xr:   claimed,
+			want: ServiceAccountSecretRef{Namespace: "org-test", Name: "test-sa", Keys: serviceAccountKeyNames},
+		},
+		"EmptySpec": {
+			xr:   claimed,
+			spec: &v1beta1.ServiceAccountSecret{},
+			want: ServiceAccountSecretRef{Namespace: "org-test", Name: "test-sa", Keys: serviceAccountKeyNames},
+		},
+		"CustomTemplate": {
+			xr:   claimed,
+			spec: &v1beta1.ServiceAccountSecret{NameTemplate: `{{ .Spec.name }}-{{ index .Labels "crossplane.io/claim-namespace" }}-signing-key`},
+			want: ServiceAccountSecretRef{Namespace: "org-test", Name: "test-org-test-signing-key", Keys: serviceAccountKeyNames},
+		},
+		"Overrides": {
+			xr: claimed,
+			spec: &v1beta1.ServiceAccountSecret{
+				NameRef:      "metadata.name",
+				NameTemplate: "ignored",
+				NamespaceRef: "spec.secretNamespace",
+				Key:          "sa.key",
+			},
+			want: ServiceAccountSecretRef{Namespace: "org-test-secrets", Name: "test-x7k2p", Keys: []string{"sa.key"}},
+		},
+		"TemplateParseError": {
+			xr:      claimed,
+			spec:    &v1beta1.ServiceAccountSecret{NameTemplate: "{{ .ClaimName"},
+			wantErr: true,
+		},
+		"TemplateExecuteError": {
+			xr:      claimed,
+			spec:    &v1beta1.ServiceAccountSecret{NameTemplate: "{{ .Cluster }}-sa"},
+			wantErr: true,
+		},
+		"MissingClaim": {
+			xr:      xr(nil),
+			wantErr: true,
+		},
+		"MissingNameRef": {
+			xr:      claimed,
+			spec:    &v1beta1.ServiceAccountSecret{NameRef: "spec.secretName"},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := newTestFunction().ResolveServiceAccountSecret(tc.xr, tc.spec)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("ResolveServiceAccountSecret() error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if tc.wantErr {
+				var keyErr *ServiceAccountKeyError
+				if !errors.As(err, &keyErr) || keyErr.Reason != reasonSecretNotResolved {
+					t.Errorf("ResolveServiceAccountSecret() error = %v, want reason %s", err, reasonSecretNotResolved)
+				}
+				return
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("ResolveServiceAccountSecret() -want +got:\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"crypto/sha1" // #nosec G505 -- IAM identifies CAs by their SHA-1 thumbprint
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+	"github.com/crossplane/crossplane-runtime/pkg/fieldpath"
+	"github.com/crossplane/function-sdk-go/resource"
+	"github.com/giantswarm/xfnlib/pkg/composite"
+
+	"github.com/giantswarm/crossplane-fn-irsa/pkg/input/v1beta1"
+)
+
+// Thumbprints of the root CAs serving the issuer on the well known endpoints
+const (
+	cloudFrontThumbprint = "06b25927c42a721631c1efd9431e648fa62e1e39"
+	s3Thumbprint         = "9e99a48a9960b14926bb7f3b02e22da2b0ab7280"
+)
+
+// errNoKnownThumbprint is returned when no thumbprint is known for the
+// partition and endpoint of the issuer
+var errNoKnownThumbprint = errors.New("no thumbprint is known")
+
+// tlsHandshakeTimeout bounds the connection to the issuer host
+const tlsHandshakeTimeout = 10 * time.Second
+
+// knownThumbprints maps a partition and endpoint to the thumbprint of the
+// root CA serving it, used when the thumbprint is computed offline.
+var knownThumbprints = map[string]string{
+	"aws/cloudfront": cloudFrontThumbprint,
+	"aws/s3":         s3Thumbprint,
+	"aws-cn/s3":      s3Thumbprint,
+}
+
+// dialTLS connects to the issuer host. It is a variable so that it can be
+// replaced when running without network access.
+var dialTLS = func(ctx context.Context, address string) (*tls.ConnectionState, error) {
+	dialer := &tls.Dialer{
+		NetDialer: &net.Dialer{Timeout: tlsHandshakeTimeout},
+		Config:    &tls.Config{MinVersion: tls.VersionTLS12},
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = conn.Close() }()
+
+	state := conn.(*tls.Conn).ConnectionState()
+	return &state, nil
+}
+
+// KnownThumbprint returns the thumbprint of the endpoint serving the issuer
+// in the given mode and partition.
+func KnownThumbprint(mode v1beta1.IssuerMode, partition Partition) (string, error) {
+	endpoint := "s3"
+	switch mode {
+	case v1beta1.IssuerModeCloudFront:
+		endpoint = "cloudfront"
+	case v1beta1.IssuerModeCustom:
+		return "", errors.Wrap(errNoKnownThumbprint, "custom issuers")
+	}
+
+	if thumbprint, ok := knownThumbprints[partition.ID+"/"+endpoint]; ok {
+		return thumbprint, nil
+	}
+	return "", errors.Wrapf(errNoKnownThumbprint, "%s in partition %s", endpoint, partition.ID)
+}
+
+// IssuerThumbprint computes the SHA-1 thumbprint of the root CA of the issuer
+// and patches it, as a list, to the thumbprint reference.
+func (f *Function) IssuerThumbprint(ctx context.Context, issuer string, mode v1beta1.IssuerMode, partition Partition, spec *v1beta1.Thumbprint, oxr *resource.Composite, composed *composite.Composition) (thumbprint string, err error) {
+	var bundle string
+	if spec.CABundleRef != "" {
+		if bundle, err = f.getStringFromPaved(oxr.Resource, spec.CABundleRef); err != nil {
+			return "", errors.Wrapf(err, "cannot get CA bundle from %q", spec.CABundleRef)
+		}
+	}
+
+	switch spec.Source {
+	case v1beta1.ThumbprintSourceCABundle:
+		thumbprint, err = caBundleThumbprint([]byte(bundle))
+	case v1beta1.ThumbprintSourceTLS:
+		thumbprint, err = f.tlsThumbprint(ctx, issuer)
+	case v1beta1.ThumbprintSourceOffline:
+		thumbprint, err = KnownThumbprint(mode, partition)
+	default:
+		if bundle != "" {
+			thumbprint, err = caBundleThumbprint([]byte(bundle))
+			break
+		}
+
+		if thumbprint, err = f.tlsThumbprint(ctx, issuer); err != nil {
+			f.log.Info("Cannot get thumbprint from issuer, using known thumbprint", "issuer", issuer, "error", err)
+			thumbprint, err = KnownThumbprint(mode, partition)
+		}
+	}
+	if err != nil {
+		return "", errors.Wrapf(err, "cannot compute thumbprint for issuer %q", issuer)
+	}
+
+	f.log.Debug("Issuer thumbprint", "issuer", issuer, "thumbprint", thumbprint)
+	if err = f.patchFieldValueToObject(spec.PatchToRef, []string{thumbprint}, composed.DesiredComposite.Resource); err != nil {
+		return "", errors.Wrapf(err, "cannot patch thumbprint to %q", spec.PatchToRef)
+	}
+
+	return thumbprint, nil
+}
+
+// DryRunThumbprint computes the issuer thumbprint without connecting to the
+// issuer. Where a TLS connection would be made, the thumbprint recorded on
+// the XR is kept, falling back to the known thumbprint if none is recorded.
+func (f *Function) DryRunThumbprint(ctx context.Context, issuer string, mode v1beta1.IssuerMode, partition Partition, spec *v1beta1.Thumbprint, oxr *resource.Composite, composed *composite.Composition) (string, error) {
+	var bundle string
+	if spec.CABundleRef != "" {
+		bundle, _ = f.getStringFromPaved(oxr.Resource, spec.CABundleRef)
+	}
+
+	switch spec.Source {
+	case v1beta1.ThumbprintSourceCABundle, v1beta1.ThumbprintSourceOffline:
+		return f.IssuerThumbprint(ctx, issuer, mode, partition, spec, oxr, composed)
+	case v1beta1.ThumbprintSourceTLS:
+	default:
+		if bundle != "" {
+			return f.IssuerThumbprint(ctx, issuer, mode, partition, spec, oxr, composed)
+		}
+	}
+
+	if recorded := f.keepThumbprint(spec, oxr, composed); recorded != "" {
+		f.log.Debug("Dry run, keeping recorded thumbprint", "issuer", issuer, "thumbprint", recorded)
+		return recorded, nil
+	}
+
+	offline := *spec
+	offline.Source = v1beta1.ThumbprintSourceOffline
+	return f.IssuerThumbprint(ctx, issuer, mode, partition, &offline, oxr, composed)
+}
+
+// keepThumbprint carries the thumbprints recorded on the observed XR forward
+// and returns the first, so that resources are rendered with the recorded
+// thumbprint rather than the known one. It returns an empty string if none
+// is recorded.
+func (f *Function) keepThumbprint(spec *v1beta1.Thumbprint, oxr *resource.Composite, composed *composite.Composition) string {
+	paved, err := fieldpath.PaveObject(oxr.Resource)
+	if err != nil {
+		return ""
+	}
+
+	recorded, err := paved.GetStringArray(spec.PatchToRef)
+	if err != nil || len(recorded) == 0 {
+		return ""
+	}
+
+	f.carryForward(spec.PatchToRef, oxr, composed)
+	return recorded[0]
+}
+
+// tlsThumbprint connects to the issuer host and returns the thumbprint of the
+// root of the verified certificate chain.
+func (f *Function) tlsThumbprint(ctx context.Context, issuer string) (string, error) {
+	u, err := url.Parse(issuer)
+	if err != nil {
+		return "", errors.Wrap(err, "cannot parse issuer URL")
+	}
+
+	address := u.Host
+	if u.Port() == "" {
+		address = net.JoinHostPort(u.Hostname(), "443")
+	}
+
+	return cachedLookup(f.discovery, "tls", func() (string, error) {
+		state, err := dialTLS(ctx, address)
+		if err != nil {
+			return "", errors.Wrapf(err, "cannot connect to %s", address)
+		}
+
+		var root *x509.Certificate
+		switch {
+		case len(state.VerifiedChains) > 0 && len(state.VerifiedChains[0]) > 0:
+			chain := state.VerifiedChains[0]
+			root = chain[len(chain)-1]
+		case len(state.PeerCertificates) > 0:
+			root = state.PeerCertificates[len(state.PeerCertificates)-1]
+		default:
+			return "", errors.Errorf("%s presented no certificates", address)
+		}
+
+		return certificateThumbprint(root), nil
+	}, address)
+}
+
+// caBundleThumbprint returns the thumbprint of the root CA in a PEM bundle,
+// the self-signed certificate if there is one or else the last certificate.
+func caBundleThumbprint(bundle []byte) (string, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		if block, bundle = pem.Decode(bundle); block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return "", errors.Wrap(err, "cannot parse certificate in CA bundle")
+		}
+		certs = append(certs, cert)
+	}
+
+	if len(certs) == 0 {
+		return "", errors.New("CA bundle contains no certificates")
+	}
+
+	for _, cert := range certs {
+		if cert.IsCA && cert.CheckSignatureFrom(cert) == nil {
+			return certificateThumbprint(cert), nil
+		}
+	}
+	return certificateThumbprint(certs[len(certs)-1]), nil
+}
+
+func certificateThumbprint(cert *x509.Certificate) string {
+	sum := sha1.Sum(cert.Raw) // #nosec G401
+	return hex.EncodeToString(sum[:])
+}
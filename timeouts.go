@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/response"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/giantswarm/crossplane-fn-irsa/pkg/input/v1beta1"
+)
+
+// responseMargin is kept free before the deadline of the request so that the
+// response can still be returned after a step timed out.
+const responseMargin = 2 * time.Second
+
+// reasonTimedOut is used when a step did not finish in time
+const reasonTimedOut = "TimedOut"
+
+// withRequestDeadline shortens the deadline of the request, if any, by the
+// response margin.
+func withRequestDeadline(ctx context.Context) (context.Context, context.CancelFunc) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return context.WithCancel(ctx)
+	}
+	return context.WithDeadline(ctx, deadline.Add(-responseMargin))
+}
+
+// stepTimeout returns the timeout of a step, preferring the Input over the
+// default of the function. Zero means the step is only bound by the request.
+func (f *Function) stepTimeout(spec *v1beta1.Timeouts, step string) time.Duration {
+	if spec == nil {
+		return f.timeout
+	}
+
+	var d *metav1.Duration
+	switch step {
+	case "hosted_zone":
+		d = spec.HostedZone
+	case "distribution":
+		d = spec.Distribution
+	case "thumbprint":
+		d = spec.Thumbprint
+	case "oidc_provider":
+		d = spec.OIDCProvider
+	case "service_account_secret":
+		d = spec.ServiceAccountSecret
+	}
+
+	if d == nil {
+		d = spec.Default
+	}
+	if d == nil {
+		return f.timeout
+	}
+	return d.Duration
+}
+
+// isTimeout reports whether a step failed because its context ran out of time.
+// A step whose request was cancelled did not time out, whatever it returned.
+func isTimeout(ctx context.Context, err error) bool {
+	if err == nil || errors.Is(ctx.Err(), context.Canceled) {
+		return false
+	}
+	return errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded)
+}
+
+// warnTimeout reports a step that timed out as a Warning on the XR and claim
+func warnTimeout(rsp *fnv1.RunFunctionResponse, err error) {
+	response.Warning(rsp, errors.Wrap(err, "step timed out, previously recorded values are kept")).
+		WithReason(reasonTimedOut).
+		TargetCompositeAndClaim()
+}
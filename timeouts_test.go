@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/giantswarm/crossplane-fn-irsa/pkg/input/v1beta1"
+)
+
+func TestStepTimeout(t *testing.T) {
+	duration := func(d time.Duration) *metav1.Duration { return &metav1.Duration{Duration: d} }
+
+	cases := map[string]struct {
+		spec *v1beta1.Timeouts
+		step string
+		want time.Duration
+	}{
+		"NoTimeouts": {
+			step: "hosted_zone",
+			want: 5 * time.Second,
+		},
+		"FunctionDefault": {
+			spec: &v1beta1.Timeouts{Thumbprint: duration(time.Second)},
+			step: "hosted_zone",
+			want: 5 * time.Second,
+		},
+		"InputDefault": {
+			spec: &v1beta1.Timeouts{Default: duration(10 * time.Second), Thumbprint: duration(time.Second)},
+			step: "oidc_provider",
+			want: 10 * time.Second,
+		},
+		"HostedZone":           {spec: &v1beta1.Timeouts{Default: duration(10 * time.Second), HostedZone: duration(time.Second)}, step: "hosted_zone", want: time.Second},
+		"Distribution":         {spec: &v1beta1.Timeouts{Default: duration(10 * time.Second), Distribution: duration(time.Second)}, step: "distribution", want: time.Second},
+		"Thumbprint":           {spec: &v1beta1.Timeouts{Default: duration(10 * time.Second), Thumbprint: duration(time.Second)}, step: "thumbprint", want: time.Second},
+		"OIDCProvider":         {spec: &v1beta1.Timeouts{Default: duration(10 * time.Second), OIDCProvider: duration(time.Second)}, step: "oidc_provider", want: time.Second},
+		"ServiceAccountSecret": {spec: &v1beta1.Timeouts{Default: duration(10 * time.Second), ServiceAccountSecret: duration(time.Second)}, step: "service_account_secret", want: time.Second},
+		"ZeroOverride": {
+			spec: &v1beta1.Timeouts{Default: duration(10 * time.Second), HostedZone: duration(0)},
+			step: "hosted_zone",
+			want: 0,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := newTestFunction()
+			f.timeout = 5 * time.Second
+
+			if got := f.stepTimeout(tc.spec, tc.step); got != tc.want {
+				t.Errorf("stepTimeout() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+// testStep starts a step under parent and returns its context
+func testStep(t *testing.T, parent context.Context, timeout time.Duration) context.Context {
+	t.Helper()
+	ctx, done := startStep(parent, "test", timeout)
+	t.Cleanup(func() { done(nil) })
+	return ctx
+}
+
+func TestIsTimeout(t *testing.T) {
+	cases := map[string]struct {
+		// stepCtx returns the context of the step once it finished
+		stepCtx func(t *testing.T) context.Context
+		err     error
+		want    bool
+	}{
+		"StepDeadline": {
+			stepCtx: func(t *testing.T) context.Context {
+				ctx := testStep(t, context.Background(), time.Millisecond)
+				<-ctx.Done()
+				return ctx
+			},
+			err:  context.DeadlineExceeded,
+			want: true,
+		},
+		"StepDeadlineWrapped": {
+			stepCtx: func(t *testing.T) context.Context {
+				ctx := testStep(t, context.Background(), time.Millisecond)
+				<-ctx.Done()
+				return ctx
+			},
+			err:  errors.Wrap(errors.New("operation error Route 53: ListHostedZonesByName"), "cannot list hosted zones"),
+			want: true,
+		},
+		"ClientDeadline": {
+			stepCtx: func(t *testing.T) context.Context {
+				ctx := testStep(t, context.Background(), time.Hour)
+				return ctx
+			},
+			err:  errors.Wrap(context.DeadlineExceeded, "rate limit wait"),
+			want: true,
+		},
+		"ParentCancelled": {
+			stepCtx: func(t *testing.T) context.Context {
+				parent, cancel := context.WithCancel(context.Background())
+				ctx := testStep(t, parent, time.Hour)
+				cancel()
+				return ctx
+			},
+			err:  context.Canceled,
+			want: false,
+		},
+		"ParentCancelledWithDeadlineError": {
+			stepCtx: func(t *testing.T) context.Context {
+				parent, cancel := context.WithCancel(context.Background())
+				ctx := testStep(t, parent, time.Hour)
+				cancel()
+				return ctx
+			},
+			err:  errors.Wrap(context.DeadlineExceeded, "rate limit wait"),
+			want: false,
+		},
+		"OtherError": {
+			stepCtx: func(t *testing.T) context.Context {
+				ctx := testStep(t, context.Background(), time.Hour)
+				return ctx
+			},
+			err:  errors.New("access denied"),
+			want: false,
+		},
+		"NoError": {
+			stepCtx: func(t *testing.T) context.Context {
+				ctx := testStep(t, context.Background(), time.Millisecond)
+				<-ctx.Done()
+				return ctx
+			},
+			want: false,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if got := isTimeout(tc.stepCtx(t), tc.err); got != tc.want {
+				t.Errorf("isTimeout() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
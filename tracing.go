@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	sdkresource "go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/giantswarm/crossplane-fn-irsa"
+
+// tracer creates all spans of this function. Spans are dropped unless
+// tracing is set up, as the global provider is a no-op by default.
+var tracer = otel.Tracer(tracerName)
+
+// TracingOptions configure the export of traces
+type TracingOptions struct {
+	Endpoint    string
+	Insecure    bool
+	SampleRatio float64
+}
+
+// setupTracing installs a global tracer provider exporting spans over OTLP
+// gRPC. The returned function flushes and stops the exporter.
+func setupTracing(ctx context.Context, opts TracingOptions) (func(context.Context) error, error) {
+	exporterOpts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(opts.Endpoint)}
+	if strings.Contains(opts.Endpoint, "://") {
+		exporterOpts = []otlptracegrpc.Option{otlptracegrpc.WithEndpointURL(opts.Endpoint)}
+	}
+	if opts.Insecure {
+		exporterOpts = append(exporterOpts, otlptracegrpc.WithInsecure())
+	}
+
+	exporter, err := otlptracegrpc.New(ctx, exporterOpts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create OTLP trace exporter")
+	}
+
+	// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES take precedence
+	res, err := sdkresource.New(ctx,
+		sdkresource.WithAttributes(semconv.ServiceName(composedName)),
+		sdkresource.WithTelemetrySDK(),
+		sdkresource.WithFromEnv(),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create trace resource")
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(opts.SampleRatio))),
+	)
+
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	return provider.Shutdown, nil
+}
+
+// startStep starts a span and a duration measurement for a step of
+// RunFunction, bounding it by timeout unless zero. The returned function ends
+// both and records the error, if any.
+func startStep(ctx context.Context, step string, timeout time.Duration) (context.Context, func(error)) {
+	start := time.Now()
+	ctx, span := tracer.Start(ctx, step, trace.WithAttributes(attribute.String("irsa.step", step)))
+
+	cancel := context.CancelFunc(func() {})
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+
+	return ctx, func(err error) {
+		cancel()
+		stepDuration.WithLabelValues(step).Observe(time.Since(start).Seconds())
+		endSpan(span, err)
+	}
+}
+
+// endSpan records the error on the span, if any, and ends it
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// addTracingMiddleware starts a client span for every AWS API call and adds
+// an event to it for every failed attempt.
+func addTracingMiddleware(stack *middleware.Stack) error {
+	err := stack.Initialize.Add(middleware.InitializeMiddlewareFunc("IRSARequestTracing", func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (out middleware.InitializeOutput, md middleware.Metadata, err error) {
+		service, operation := awsmiddleware.GetServiceID(ctx), awsmiddleware.GetOperationName(ctx)
+		ctx, span := tracer.Start(ctx, service+"."+operation,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				semconv.RPCSystemKey.String("aws-api"),
+				semconv.RPCService(service),
+				semconv.RPCMethod(operation),
+				attribute.String("aws.region", awsmiddleware.GetRegion(ctx)),
+			),
+		)
+
+		out, md, err = next.HandleInitialize(ctx, in)
+		if requestID, ok := awsmiddleware.GetRequestIDMetadata(md); ok {
+			span.SetAttributes(attribute.String("aws.request_id", requestID))
+		}
+		endSpan(span, err)
+		return
+	}), middleware.After)
+	if err != nil {
+		return err
+	}
+
+	return stack.Finalize.Insert(middleware.FinalizeMiddlewareFunc("IRSAAttemptTracing", func(ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler) (out middleware.FinalizeOutput, md middleware.Metadata, err error) {
+		out, md, err = next.HandleFinalize(ctx, in)
+		if err != nil {
+			trace.SpanFromContext(ctx).AddEvent("attempt failed", trace.WithAttributes(attribute.String("error", err.Error())))
+		}
+		return
+	}), "Retry", middleware.After)
+}
+
+// endRunSpan ends the span of a RunFunction call, marking it as failed if the
+// response contains a fatal result
+func endRunSpan(span trace.Span, rsp *fnv1.RunFunctionResponse) {
+	for _, r := range rsp.GetResults() {
+		if r.GetSeverity() == fnv1.Severity_SEVERITY_FATAL {
+			span.SetStatus(codes.Error, r.GetMessage())
+			break
+		}
+	}
+	span.End()
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"time"
+
 	"github.com/crossplane/crossplane-runtime/pkg/logging"
 	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -30,7 +32,11 @@ type XRSpec struct {
 // Function returns whatever response you ask it to.
 type Function struct {
 	fnv1.UnimplementedFunctionRunnerServiceServer
-	log logging.Logger
+	log         logging.Logger
+	clients     *clientCache
+	discovery   *discoveryCache
+	timeout     time.Duration
+	concurrency int
 }
 
 // IRSAImportXRObject is the information we are going to pull from the XR